@@ -4,20 +4,21 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"os"
 
 	"github.com/gnolang/gno/pkgs/commands"
 	gno "github.com/gnolang/gno/pkgs/gnolang"
 )
 
 type buildCfg struct {
-	verbose  bool
-	goBinary string
+	verbose     bool
+	goBinary    string
+	incremental bool
 }
 
 var defaultBuildOptions = &buildCfg{
-	verbose:  false,
-	goBinary: "go",
+	verbose:     false,
+	goBinary:    "go",
+	incremental: false,
 }
 
 func newBuildCmd(io *commands.IO) *commands.Command {
@@ -30,8 +31,8 @@ func newBuildCmd(io *commands.IO) *commands.Command {
 			ShortHelp:  "Builds the specified gno package",
 		},
 		cfg,
-		func(_ context.Context, args []string) error {
-			return execBuild(cfg, args, io)
+		func(ctx context.Context, args []string) error {
+			return execBuild(ctx, cfg, args, io)
 		},
 	)
 }
@@ -50,21 +51,34 @@ func (c *buildCfg) RegisterFlags(fs *flag.FlagSet) {
 		defaultBuildOptions.goBinary,
 		"go binary to use for building",
 	)
+
+	fs.BoolVar(
+		&c.incremental,
+		"incremental",
+		defaultBuildOptions.incremental,
+		"skip the packages whose sources didn't change since their last successful build",
+	)
 }
 
-func execBuild(cfg *buildCfg, args []string, io *commands.IO) error {
+func execBuild(ctx context.Context, cfg *buildCfg, args []string, io *commands.IO) error {
 	if len(args) < 1 {
 		return flag.ErrHelp
 	}
 
-	paths, err := gnoPackagesFromArgs(args)
+	paths, err := GnoPackagesFromArgs(args, true)
 	if err != nil {
 		return fmt.Errorf("list packages: %w", err)
 	}
 
+	// fail once, rather than for each package, without a go toolchain.
+	cfg.goBinary, err = gno.LookGoBinary(cfg.goBinary)
+	if err != nil {
+		return err
+	}
+
 	errCount := 0
 	for _, pkgPath := range paths {
-		err = goBuildFileOrPkg(pkgPath, cfg)
+		err = goBuildFileOrPkg(ctx, pkgPath, cfg, io)
 		if err != nil {
 			err = fmt.Errorf("%s: build pkg: %w", pkgPath, err)
 			io.ErrPrintfln("%s\n", err.Error())
@@ -80,13 +94,20 @@ func execBuild(cfg *buildCfg, args []string, io *commands.IO) error {
 	return nil
 }
 
-func goBuildFileOrPkg(fileOrPkg string, cfg *buildCfg) error {
+func goBuildFileOrPkg(ctx context.Context, fileOrPkg string, cfg *buildCfg, io *commands.IO) error {
 	verbose := cfg.verbose
 	goBinary := cfg.goBinary
 
 	if verbose {
-		fmt.Fprintf(os.Stderr, "%s\n", fileOrPkg)
+		io.ErrPrintfln("%s", fileOrPkg)
 	}
 
-	return gno.PrecompileBuildPackage(fileOrPkg, goBinary)
+	if cfg.incremental && isDir(fileOrPkg) {
+		skipped, err := gno.PrecompileBuildPackageIncremental(ctx, fileOrPkg, goBinary)
+		if skipped && verbose {
+			io.ErrPrintfln("%s: up to date", fileOrPkg)
+		}
+		return err
+	}
+	return gno.PrecompileBuildPackageContext(ctx, fileOrPkg, goBinary)
 }
@@ -32,6 +32,7 @@ func newGnodevCmd(io *commands.IO) *commands.Command {
 		newRunCmd(io),
 		newBuildCmd(io),
 		newPrecompileCmd(io),
+		newWatchCmd(io),
 		newTestCmd(io),
 		newModCmd(io),
 		newReplCmd(),
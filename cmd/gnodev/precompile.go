@@ -2,49 +2,252 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gnolang/gno/pkgs/commands"
 	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"go.uber.org/multierr"
 )
 
 type importPath string
 
+// normalize returns the absolute and cleaned path of the package directory,
+// so that the different spellings of a path are the same package.
+func (p importPath) normalize() importPath {
+	abs, err := filepath.Abs(string(p))
+	if err != nil {
+		return importPath(filepath.Clean(string(p)))
+	}
+	return importPath(abs)
+}
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// stdinFilename is the name given to a .gno source read from stdin.
+const stdinFilename = "stdin.gno"
+
 type precompileCfg struct {
-	verbose     bool
-	skipFmt     bool
-	skipImports bool
-	goBinary    string
-	gofmtBinary string
-	output      string
+	verbose      bool
+	skipFmt      bool
+	vet          bool
+	gobuild      bool
+	dryRun       bool
+	skipImports  bool
+	goBinary     string
+	gofmtBinary  string
+	output       string
+	rootDir      string
+	cacheDir     string
+	rewriteRules string
+	outputFormat string
+	runTimeout   time.Duration
+	jobs         int
+	goVersion    string
 }
 
 type precompileOptions struct {
 	cfg *precompileCfg
+	io  *commands.IO
+	// ioMu serializes the writes to io, which may
+	// be shared by concurrent precompilations.
+	ioMu sync.Mutex
 	// precompiled is the set of packages already
-	// precompiled from .gno to .go.
+	// precompiled from .gno to .go, guarded by the
+	// embedded RWMutex.
 	precompiled map[importPath]struct{}
+	// built is the set of output directories already
+	// built with go build, also guarded by the RWMutex.
+	built map[string]struct{}
+	sync.RWMutex
+	// rewriteRules overrides the default gno import rewrite rules.
+	rewriteRules gno.RewriteRules
+	// report collects the outcome of each precompiled
+	// file, guarded by the embedded RWMutex.
+	report gno.PrecompileReport
+	// timings collects the time spent on each output
+	// package, guarded by the embedded RWMutex.
+	timings map[string]*pkgTimings
 }
 
-func newPrecompileOptions(cfg *precompileCfg) *precompileOptions {
-	return &precompileOptions{cfg, map[importPath]struct{}{}}
+// pkgTimings is the time spent precompiling and building a package.
+type pkgTimings struct {
+	files int
+	gno.PrecompileTimings
+}
+
+func newPrecompileOptions(cfg *precompileCfg, io *commands.IO) *precompileOptions {
+	return &precompileOptions{
+		cfg:         cfg,
+		io:          io,
+		precompiled: map[importPath]struct{}{},
+		built:       map[string]struct{}{},
+		timings:     map[string]*pkgTimings{},
+	}
 }
 
 func (p *precompileOptions) getFlags() *precompileCfg {
 	return p.cfg
 }
 
+// logf prints progress output to the error stream; it does nothing unless
+// verbose output is enabled.
+func (p *precompileOptions) logf(format string, args ...interface{}) {
+	if !p.cfg.verbose || p.io == nil {
+		return
+	}
+	p.ioMu.Lock()
+	defer p.ioMu.Unlock()
+	p.io.ErrPrintfln(format, args...)
+}
+
+// printf prints the result of the precompilation to the output stream; it
+// does nothing when the result is reported as JSON.
+func (p *precompileOptions) printf(format string, args ...interface{}) {
+	if p.io == nil || p.cfg.outputFormat == outputFormatJSON {
+		return
+	}
+	p.ioMu.Lock()
+	defer p.ioMu.Unlock()
+	p.io.Printfln(format, args...)
+}
+
+func (p *precompileOptions) addFileReport(fileReport gno.PrecompileFileReport) {
+	p.Lock()
+	defer p.Unlock()
+	p.report.Files = append(p.report.Files, fileReport)
+}
+
+// setFileError records err as the error of srcPath in the report.
+func (p *precompileOptions) setFileError(srcPath string, err error) {
+	p.Lock()
+	defer p.Unlock()
+	for i := range p.report.Files {
+		if p.report.Files[i].SourcePath == srcPath {
+			p.report.Files[i].Error = err.Error()
+		}
+	}
+}
+
+// addTimings adds the timings of a file of the package in the output
+// directory dir, or of the package itself if files is 0.
+func (p *precompileOptions) addTimings(dir string, files int, timings gno.PrecompileTimings) {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.timings[dir]
+	if !ok {
+		t = &pkgTimings{}
+		p.timings[dir] = t
+	}
+	t.files += files
+	t.Add(timings)
+}
+
+// logTimings prints the timings of the packages, the slowest first, and
+// their total.
+func (p *precompileOptions) logTimings() {
+	p.RLock()
+	dirs := make([]string, 0, len(p.timings))
+	var total pkgTimings
+	for dir, t := range p.timings {
+		dirs = append(dirs, dir)
+		total.files += t.files
+		total.Add(t.PrecompileTimings)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		ti, tj := p.timings[dirs[i]].Total(), p.timings[dirs[j]].Total()
+		if ti != tj {
+			return ti > tj
+		}
+		return dirs[i] < dirs[j]
+	})
+	lines := make([]string, 0, len(dirs)+1)
+	for _, dir := range dirs {
+		lines = append(lines, formatTimings(dir, p.timings[dir]))
+	}
+	p.RUnlock()
+
+	lines = append(lines, formatTimings("total", &total))
+	for _, line := range lines {
+		p.logf("%s", line)
+	}
+}
+
+func formatTimings(name string, t *pkgTimings) string {
+	return fmt.Sprintf("%s: %d files in %s (parse %s, translate %s, verify %s, build %s)",
+		name, t.files, fmtDuration(t.Total()), fmtDuration(t.Parse), fmtDuration(t.Translate), fmtDuration(t.Verify), fmtDuration(t.Build))
+}
+
 func (p *precompileOptions) isPrecompiled(pkg importPath) bool {
-	_, precompiled := p.precompiled[pkg]
+	key := pkg.normalize()
+	p.RLock()
+	defer p.RUnlock()
+	_, precompiled := p.precompiled[key]
 	return precompiled
 }
 
 func (p *precompileOptions) markAsPrecompiled(pkg importPath) {
-	p.precompiled[pkg] = struct{}{}
+	key := pkg.normalize()
+	p.Lock()
+	defer p.Unlock()
+	p.precompiled[key] = struct{}{}
+}
+
+// startPrecompile marks pkg as precompiled, and reports whether it wasn't
+// already, in which case the caller is responsible for precompiling it.
+func (p *precompileOptions) startPrecompile(pkg importPath) bool {
+	key := pkg.normalize()
+	p.Lock()
+	defer p.Unlock()
+	if _, precompiled := p.precompiled[key]; precompiled {
+		return false
+	}
+	p.precompiled[key] = struct{}{}
+	return true
+}
+
+// buildPkg runs go build on the precompiled package in dir, unless it was
+// already built.
+func (p *precompileOptions) buildPkg(ctx context.Context, dir string) error {
+	p.Lock()
+	if _, built := p.built[dir]; built {
+		p.Unlock()
+		return nil
+	}
+	p.built[dir] = struct{}{}
+	p.Unlock()
+
+	goBinary := p.cfg.goBinary
+	if goBinary == "" {
+		goBinary = "go"
+	}
+	if p.cfg.runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.runTimeout)
+		defer cancel()
+	}
+	p.logf("build %s", dir)
+	start := time.Now()
+	err := gno.PrecompileBuildPackageContext(ctx, dir, goBinary)
+	p.addTimings(dir, 0, gno.PrecompileTimings{Build: time.Since(start)})
+	return err
 }
 
 func newPrecompileCmd(io *commands.IO) *commands.Command {
@@ -55,10 +258,11 @@ func newPrecompileCmd(io *commands.IO) *commands.Command {
 			Name:       "precompile",
 			ShortUsage: "precompile [flags] <package> [<package>...]",
 			ShortHelp:  "Precompiles .gno files to .go",
+			LongHelp:   "Precompiles .gno files to .go; with a single - argument, precompiles the .gno source read from stdin to stdout",
 		},
 		cfg,
-		func(_ context.Context, args []string) error {
-			return execPrecompile(cfg, args, io)
+		func(ctx context.Context, args []string) error {
+			return execPrecompile(ctx, cfg, args, io)
 		},
 	)
 }
@@ -78,6 +282,27 @@ func (c *precompileCfg) RegisterFlags(fs *flag.FlagSet) {
 		"do not check syntax of generated .go files",
 	)
 
+	fs.BoolVar(
+		&c.vet,
+		"vet",
+		false,
+		"run go vet on generated .go files",
+	)
+
+	fs.BoolVar(
+		&c.gobuild,
+		"gobuild",
+		false,
+		"run go build on the packages of the generated .go files (implies the fmt check, ignored in dry-run mode)",
+	)
+
+	fs.BoolVar(
+		&c.dryRun,
+		"dry-run",
+		false,
+		"print the .go files that would be written, without writing them",
+	)
+
 	fs.BoolVar(
 		&c.skipImports,
 		"skip-imports",
@@ -95,8 +320,8 @@ func (c *precompileCfg) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(
 		&c.gofmtBinary,
 		"go-fmt-binary",
-		"gofmt",
-		"gofmt binary to use for syntax checking",
+		"",
+		"gofmt binary to use for syntax checking (checked in-process if empty)",
 	)
 
 	fs.StringVar(
@@ -105,31 +330,196 @@ func (c *precompileCfg) RegisterFlags(fs *flag.FlagSet) {
 		".",
 		"output directory",
 	)
+
+	fs.StringVar(
+		&c.rootDir,
+		"root-dir",
+		"",
+		"root of the gno repository, in which the imported packages are looked up (defaults to the current directory), and of the output directory structure, which mirrors the package paths relative to it (defaults to the clone location of github.com/gnolang/gno)",
+	)
+
+	fs.StringVar(
+		&c.cacheDir,
+		"cache-dir",
+		"",
+		"directory used to cache precompiled files (disabled if empty)",
+	)
+
+	fs.StringVar(
+		&c.rewriteRules,
+		"rewrite-rules",
+		"",
+		"comma-separated list of before=after import rewrites (a trailing slash rewrites subpackages)",
+	)
+
+	fs.StringVar(
+		&c.outputFormat,
+		"output-format",
+		outputFormatText,
+		"format of the results: text, or json to print a report of every precompiled file",
+	)
+
+	fs.DurationVar(
+		&c.runTimeout,
+		"run-timeout",
+		30*time.Second,
+		"max duration of each go build (0 means no timeout)",
+	)
+
+	fs.IntVar(
+		&c.jobs,
+		"jobs",
+		runtime.NumCPU(),
+		"number of files to precompile in parallel",
+	)
+
+	fs.StringVar(
+		&c.goVersion,
+		"go-version",
+		"",
+		"go language version required by the generated files (e.g. go1.19)",
+	)
 }
 
-func execPrecompile(cfg *precompileCfg, args []string, io *commands.IO) error {
+func execPrecompile(ctx context.Context, cfg *precompileCfg, args []string, io *commands.IO) error {
 	if len(args) < 1 {
 		return flag.ErrHelp
 	}
 
+	// precompile stdin to stdout.
+	if len(args) == 1 && args[0] == "-" {
+		return precompileStdin(cfg, io)
+	}
+
 	// precompile .gno files.
-	paths, err := gnoFilesFromArgs(args)
+	paths, err := GnoFilesFromArgs(args, true)
 	if err != nil {
 		return fmt.Errorf("list paths: %w", err)
 	}
 
-	opts := newPrecompileOptions(cfg)
-	errCount := 0
-	for _, filepath := range paths {
-		err = precompileFile(filepath, opts)
+	switch cfg.outputFormat {
+	case "", outputFormatText, outputFormatJSON:
+	default:
+		return fmt.Errorf("invalid output format %q", cfg.outputFormat)
+	}
+
+	// fail before precompiling anything without a go toolchain.
+	if cfg.vet || (cfg.gobuild && !cfg.dryRun) {
+		cfg.goBinary, err = gno.LookGoBinary(cfg.goBinary)
 		if err != nil {
-			err = fmt.Errorf("%s: precompile: %w", filepath, err)
-			io.ErrPrintfln("%s", err.Error())
+			return err
+		}
+	}
+
+	opts := newPrecompileOptions(cfg, io)
+	if cfg.rewriteRules != "" {
+		opts.rewriteRules, err = parseRewriteRules(cfg.rewriteRules)
+		if err != nil {
+			return fmt.Errorf("parse rewrite rules: %w", err)
+		}
+	}
+
+	graph, err := newPrecompileGraph(paths, cfg.rootDir, opts.rewriteRules, !cfg.skipImports)
+	if err != nil {
+		return err
+	}
 
+	errCount := 0
+
+	// precompile the imported packages first, level by level, so that each
+	// package is built after all the packages it imports.
+	for _, pkgs := range graph.importedPkgs() {
+		pkgErrs := make([]error, len(pkgs))
+		runJobs(ctx, cfg.jobs, len(pkgs), func(i int) {
+			pkgErrs[i] = precompilePkgContext(ctx, pkgs[i], opts)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for i, err := range pkgErrs {
+			if err == nil {
+				continue
+			}
+			if cfg.outputFormat != outputFormatJSON {
+				io.ErrPrintfln("%s: precompile: %s", pkgs[i], err.Error())
+			}
 			errCount++
 		}
 	}
 
+	// precompile the files with a pool of workers.
+	errs := make([]error, len(paths))
+	targets := make([]string, len(paths))
+	runJobs(ctx, cfg.jobs, len(paths), func(i int) {
+		targets[i], errs[i] = precompileFileContext(ctx, paths[i], opts)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// report the errors sorted by path, whatever the order of completion.
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return paths[order[a]] < paths[order[b]]
+	})
+
+	for _, i := range order {
+		if errs[i] == nil {
+			continue
+		}
+		if cfg.outputFormat != outputFormatJSON {
+			err := fmt.Errorf("%s: precompile: %w", paths[i], errs[i])
+			io.ErrPrintfln("%s", err.Error())
+		}
+
+		errCount++
+	}
+
+	// build the packages of the precompiled files, once all their files
+	// are generated, in the order of their imports; the imported packages
+	// were built while precompiling.
+	if cfg.gobuild && !cfg.dryRun {
+		buildOrder := append([]int{}, order...)
+		sort.SliceStable(buildOrder, func(a, b int) bool {
+			return graph.level(filepath.Dir(paths[buildOrder[a]])) < graph.level(filepath.Dir(paths[buildOrder[b]]))
+		})
+		for _, i := range buildOrder {
+			if errs[i] != nil {
+				continue
+			}
+			if err := opts.buildPkg(ctx, filepath.Dir(targets[i])); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				err = fmt.Errorf("build: %w", err)
+				if cfg.outputFormat == outputFormatJSON {
+					opts.setFileError(paths[i], err)
+				} else {
+					io.ErrPrintfln("%s: %s", paths[i], err.Error())
+				}
+
+				errCount++
+			}
+		}
+	}
+
+	if cfg.verbose {
+		opts.logTimings()
+	}
+
+	if cfg.outputFormat == outputFormatJSON {
+		files := opts.report.Files
+		sort.Slice(files, func(a, b int) bool {
+			return files[a].SourcePath < files[b].SourcePath
+		})
+		if err := opts.report.WriteJSON(io.Out); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	}
+
 	if errCount > 0 {
 		return fmt.Errorf("%d precompile errors", errCount)
 	}
@@ -137,85 +527,356 @@ func execPrecompile(cfg *precompileCfg, args []string, io *commands.IO) error {
 	return nil
 }
 
+// runJobs calls fn for each index in [0, n) with a pool of jobs workers, or
+// one per CPU if jobs is not positive, until ctx is done.
+func runJobs(ctx context.Context, jobs int, n int, fn func(i int)) {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// precompileStdin precompiles the .gno source read from io.In, and writes
+// its translation to io.Out.
+func precompileStdin(cfg *precompileCfg, io *commands.IO) error {
+	opts := gno.DefaultPrecompileOptions()
+	if cfg.rewriteRules != "" {
+		rules, err := parseRewriteRules(cfg.rewriteRules)
+		if err != nil {
+			return fmt.Errorf("parse rewrite rules: %w", err)
+		}
+		opts.RewriteRules = rules
+	}
+
+	if err := gno.PrecompileSource(io.In, io.Out, stdinFilename, opts); err != nil {
+		return fmt.Errorf("%s: precompile: %w", stdinFilename, err)
+	}
+	return nil
+}
+
 func precompilePkg(pkgPath importPath, opts *precompileOptions) error {
-	if opts.isPrecompiled(pkgPath) {
+	return precompilePkgContext(context.Background(), pkgPath, opts)
+}
+
+// precompilePkgContext is like precompilePkg, but stops and returns
+// ctx.Err() as soon as ctx is done.
+func precompilePkgContext(ctx context.Context, pkgPath importPath, opts *precompileOptions) error {
+	if !opts.startPrecompile(pkgPath) {
 		return nil
 	}
-	opts.markAsPrecompiled(pkgPath)
 
 	files, err := filepath.Glob(filepath.Join(string(pkgPath), "*.gno"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// precompile all the files, so that all their errors are reported
+	// at once.
+	var (
+		targetDir string
+		errs      error
+	)
 	for _, file := range files {
-		if err = precompileFile(file, opts); err != nil {
-			return fmt.Errorf("%s: %w", file, err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		targetPath, err := precompileFileContext(ctx, file, opts)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		targetDir = filepath.Dir(targetPath)
+	}
+	if errs != nil {
+		return errs
+	}
+
+	// build the package once all its files are generated, if `Gobuild`
+	// sets to true.
+	flags := opts.getFlags()
+	if flags.gobuild && !flags.dryRun && targetDir != "" {
+		if err := opts.buildPkg(ctx, targetDir); err != nil {
+			return fmt.Errorf("%s: build: %w", pkgPath, err)
 		}
 	}
 
 	return nil
 }
 
-func precompileFile(srcPath string, opts *precompileOptions) error {
-	flags := opts.getFlags()
-	gofmt := flags.gofmtBinary
-	if gofmt == "" {
-		gofmt = "gofmt"
-	}
+// precompileFile precompiles the .gno file at srcPath, and returns the
+// absolute path of the generated .go file (which is not written in dry-run
+// mode).
+func precompileFile(srcPath string, opts *precompileOptions) (string, error) {
+	return precompileFileContext(context.Background(), srcPath, opts)
+}
 
-	if flags.verbose {
-		fmt.Fprintf(os.Stderr, "%s\n", srcPath)
+// precompileFileContext is like precompileFile, but stops precompiling the
+// imported packages as soon as ctx is done.
+func precompileFileContext(ctx context.Context, srcPath string, opts *precompileOptions) (string, error) {
+	fileReport := gno.PrecompileFileReport{SourcePath: srcPath}
+	targetPath, err := precompileFileReport(ctx, srcPath, opts, &fileReport)
+	if err != nil {
+		fileReport.Error = err.Error()
 	}
+	opts.addFileReport(fileReport)
+	return targetPath, err
+}
+
+// precompileFileReport precompiles the .gno file at srcPath, filling
+// fileReport along the way.
+func precompileFileReport(ctx context.Context, srcPath string, opts *precompileOptions, fileReport *gno.PrecompileFileReport) (string, error) {
+	flags := opts.getFlags()
+
+	opts.logf("%s", srcPath)
 
 	// parse .gno.
 	source, err := os.ReadFile(srcPath)
 	if err != nil {
-		return fmt.Errorf("read: %w", err)
+		return "", fmt.Errorf("read: %w", err)
 	}
 
 	// compute attributes based on filename.
 	targetFilename, tags := gno.GetPrecompileFilenameAndTags(srcPath)
 
-	// preprocess.
-	precompileRes, err := gno.Precompile(string(source), tags, srcPath)
-	if err != nil {
-		return fmt.Errorf("%w", err)
+	// preprocess, or reuse a previously cached translation.
+	var (
+		translated []byte
+		imports    []*ast.ImportSpec
+		cachePath  string
+		timings    gno.PrecompileTimings
+	)
+	if flags.cacheDir != "" {
+		cachePath = precompileCachePath(flags.cacheDir, source, tags+","+flags.goVersion, opts.rewriteRules)
+		translated, imports, err = readPrecompileCache(cachePath)
+		if err != nil {
+			return "", fmt.Errorf("read cache: %w", err)
+		}
+	}
+	if translated == nil {
+		precompileOpts := gno.DefaultPrecompileOptions()
+		precompileOpts.RewriteRules = opts.rewriteRules
+		precompileOpts.GoVersion = flags.goVersion
+		precompileRes, err := gno.PrecompileWithOptions(string(source), tags, srcPath, precompileOpts)
+		if precompileRes != nil {
+			fileReport.Diagnostics = precompileRes.Diagnostics
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w", err)
+		}
+		translated = []byte(precompileRes.Translated)
+		imports = precompileRes.Imports
+		timings = precompileRes.Timings
+
+		// the cache doesn't store the diagnostics: the files with any are
+		// translated again on each run, so that they are reported.
+		if cachePath != "" && !flags.dryRun && len(fileReport.Diagnostics) == 0 {
+			if err := WriteDirFile(cachePath, translated); err != nil {
+				return "", fmt.Errorf("write cache: %w", err)
+			}
+		}
 	}
 
 	// resolve target path
 	var targetPath string
 	if flags.output != "." {
-		path, err := ResolvePath(flags.output, importPath(filepath.Dir(srcPath)))
+		path, err := ResolvePath(flags.output, flags.rootDir, importPath(filepath.Dir(srcPath)))
 		if err != nil {
-			return fmt.Errorf("resolve output path: %w", err)
+			return "", fmt.Errorf("resolve output path: %w", err)
 		}
 		targetPath = filepath.Join(path, targetFilename)
 	} else {
 		targetPath = filepath.Join(filepath.Dir(srcPath), targetFilename)
 	}
+	targetPath, err = filepath.Abs(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("resolve output path: %w", err)
+	}
+	fileReport.TargetPath = targetPath
+
+	// in dry-run mode, report the target path and write the .go file to a
+	// temporary directory instead, so that it can still be checked.
+	checkPath := targetPath
+	if flags.dryRun {
+		opts.printf("%s -> %s", srcPath, targetPath)
+
+		tmpDir, err := os.MkdirTemp("", "gno-precompile")
+		if err != nil {
+			return "", fmt.Errorf("create temp dir: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		checkPath = filepath.Join(tmpDir, targetFilename)
+	}
 
 	// write .go file.
-	err = WriteDirFile(targetPath, []byte(precompileRes.Translated))
+	err = WriteDirFile(checkPath, translated)
 	if err != nil {
-		return fmt.Errorf("write .go file: %w", err)
+		return "", fmt.Errorf("write .go file: %w", err)
 	}
+	fileReport.Written = !flags.dryRun
 
-	// check .go fmt, if `SkipFmt` sets to false.
-	if !flags.skipFmt {
-		err = gno.PrecompileVerifyFile(targetPath, gofmt)
+	// copy the files embedded with //go:embed next to the .go file, if it
+	// is not written next to the .gno file.
+	srcDir, err := filepath.Abs(filepath.Dir(srcPath))
+	if err != nil {
+		return "", fmt.Errorf("resolve source dir: %w", err)
+	}
+	if checkDir := filepath.Dir(checkPath); checkDir != srcDir {
+		if err := copyEmbeddedFiles(translated, srcDir, checkDir); err != nil {
+			return "", fmt.Errorf("copy embedded files: %w", err)
+		}
+	}
+
+	// check .go fmt, if `SkipFmt` sets to false or `Gobuild` sets to true:
+	// there is no point in building a file that doesn't even parse.
+	if !flags.skipFmt || flags.gobuild {
+		start := time.Now()
+		err = gno.PrecompileVerifyFile(checkPath, flags.gofmtBinary)
+		timings.Verify = time.Since(start)
 		if err != nil {
-			return fmt.Errorf("check .go file: %w", err)
+			return "", fmt.Errorf("check .go file: %w", err)
 		}
 	}
+	opts.addTimings(filepath.Dir(targetPath), 1, timings)
 
-	// precompile imported packages, if `SkipImports` sets to false
+	// run go vet on the .go file, if `Vet` sets to true.
+	if flags.vet {
+		goBinary := flags.goBinary
+		if goBinary == "" {
+			goBinary = "go"
+		}
+		err = gno.PrecompileVetFile(checkPath, tags, goBinary)
+		if err != nil {
+			return "", fmt.Errorf("vet .go file: %w", err)
+		}
+	}
+
+	// precompile imported packages, if `SkipImports` sets to false; the
+	// file fails with them.
+	var errs error
 	if !flags.skipImports {
-		importPaths := getPathsFromImportSpec(precompileRes.Imports)
+		importPaths := GetPathsFromImportSpec(flags.rootDir, imports)
 		for _, path := range importPaths {
-			precompilePkg(path, opts)
+			if err := precompilePkgContext(ctx, path, opts); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("import %s: %w", path, err))
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	return targetPath, errs
+}
+
+// copyEmbeddedFiles copies the files of srcDir embedded by the //go:embed
+// directives of the translated source to dstDir, at the same relative paths.
+func copyEmbeddedFiles(translated []byte, srcDir, dstDir string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), "", translated, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	patterns, err := gno.EmbedPatterns(f)
+	if err != nil || len(patterns) == 0 {
+		return err
+	}
+
+	var files []string
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
 		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	assets, err := gno.MatchEmbedPatterns(patterns, files)
+	if err != nil {
+		return err
 	}
 
+	for _, asset := range assets {
+		dst := filepath.Join(dstDir, filepath.FromSlash(asset))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(srcDir, filepath.FromSlash(asset)), dst); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// precompileCachePath returns the path of the cache entry for the given
+// source, tags and rewrite rules, keyed on their SHA-256 hash.
+func precompileCachePath(cacheDir string, source []byte, tags string, rules gno.RewriteRules) string {
+	h := sha256.New()
+	h.Write(source)
+	h.Write([]byte{0})
+	h.Write([]byte(tags))
+	for _, rule := range rules {
+		fmt.Fprintf(h, "\x00%s=%s", rule.Before, rule.After)
+	}
+	return filepath.Join(cacheDir, hex.EncodeToString(h.Sum(nil))+".go")
+}
+
+// readPrecompileCache returns the cached translation stored at path with its
+// imports, or a nil slice if there is no such entry.
+func readPrecompileCache(path string) ([]byte, []*ast.ImportSpec, error) {
+	translated, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), path, translated, parser.ImportsOnly)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return translated, f.Imports, nil
+}
+
+// parseRewriteRules parses a comma-separated list of before=after import
+// rewrite rules.
+func parseRewriteRules(s string) (gno.RewriteRules, error) {
+	var rules gno.RewriteRules
+	for _, pair := range strings.Split(s, ",") {
+		before, after, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q, expected before=after", pair)
+		}
+		rules = append(rules, gno.RewriteRule{
+			Before: strings.TrimSpace(before),
+			After:  strings.TrimSpace(after),
+		})
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
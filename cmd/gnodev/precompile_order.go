@@ -0,0 +1,244 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"github.com/gnolang/gno/pkgs/std"
+)
+
+// precompileGraph is the graph of the imports between the packages of a
+// precompilation, identified by their cleaned directory.
+type precompileGraph struct {
+	rules gno.RewriteRules
+	// rootDir is the root of the gno repository, in which the imported
+	// packages are looked up.
+	rootDir string
+	// roots maps the directories of the precompiled files to these files;
+	// only they are read for the imports of their package.
+	roots map[string][]string
+	// walkImports makes the graph include the imported packages, not only
+	// the roots.
+	walkImports bool
+	// paths maps the imported packages to their path, as precompilePkg
+	// expects it.
+	paths map[string]importPath
+	// gnoPaths maps the imported packages to the gno path they are first
+	// imported with.
+	gnoPaths map[string]string
+	// imports maps the packages to the packages of the graph they import.
+	imports map[string][]string
+	// levels maps the packages to their level: 0 if they import no other
+	// package of the graph, or one more than the highest level of the
+	// packages they import.
+	levels map[string]int
+}
+
+// pkgImport is a package imported by a package of the graph.
+type pkgImport struct {
+	gnoPath string
+	path    importPath
+}
+
+// newPrecompileGraph returns the import graph of the packages of the .gno
+// files at paths, and of the packages they import, directly or not, if
+// walkImports is set; the imported packages are looked up in the gno
+// repository at rootDir. It returns the *gno.ImportCycleError of
+// gno.CheckImportCycles if the imports are cyclic once rewritten.
+func newPrecompileGraph(paths []string, rootDir string, rules gno.RewriteRules, walkImports bool) (*precompileGraph, error) {
+	if len(rules) == 0 {
+		rules = gno.DefaultRewriteRules
+	}
+	g := &precompileGraph{
+		rules:       rules,
+		rootDir:     rootDir,
+		roots:       map[string][]string{},
+		walkImports: walkImports,
+		paths:       map[string]importPath{},
+		gnoPaths:    map[string]string{},
+		imports:     map[string][]string{},
+		levels:      map[string]int{},
+	}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		g.roots[dir] = append(g.roots[dir], path)
+	}
+
+	rootDirs := make([]string, 0, len(g.roots))
+	for dir := range g.roots {
+		rootDirs = append(rootDirs, dir)
+	}
+	sort.Strings(rootDirs)
+
+	// the packages are listed breadth first, the roots first.
+	dirs := append([]string{}, rootDirs...)
+	for i := 0; i < len(dirs); i++ {
+		dir := dirs[i]
+		for _, imported := range g.pkgImports(dir) {
+			importedDir := filepath.Clean(string(imported.path))
+			if importedDir == dir {
+				continue
+			}
+			if _, isRoot := g.roots[importedDir]; !isRoot {
+				if !g.walkImports {
+					continue
+				}
+				if _, ok := g.paths[importedDir]; !ok {
+					g.paths[importedDir] = imported.path
+					g.gnoPaths[importedDir] = imported.gnoPath
+					dirs = append(dirs, importedDir)
+				}
+			}
+			g.imports[dir] = append(g.imports[dir], importedDir)
+		}
+	}
+
+	mempkgs := make([]*std.MemPackage, 0, len(dirs))
+	for _, dir := range dirs {
+		mempkgs = append(mempkgs, g.memPackage(dir))
+	}
+	if err := gno.CheckImportCycles(mempkgs, g.rules); err != nil {
+		return nil, err
+	}
+
+	for _, dir := range rootDirs {
+		g.visit(dir)
+	}
+	return g, nil
+}
+
+// level returns the level of the package in dir.
+func (g *precompileGraph) level(dir string) int {
+	return g.levels[filepath.Clean(dir)]
+}
+
+// importedPkgs returns the imported packages that are not roots, grouped by
+// level: the packages of a group only import packages of the previous
+// groups.
+func (g *precompileGraph) importedPkgs() [][]importPath {
+	var groups [][]importPath
+	for dir, path := range g.paths {
+		level := g.levels[dir]
+		for len(groups) <= level {
+			groups = append(groups, nil)
+		}
+		groups[level] = append(groups[level], path)
+	}
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i] < group[j]
+		})
+	}
+	return groups
+}
+
+// visit computes the level of the package in dir, and of the packages it
+// imports. The imports are not cyclic, as checked by gno.CheckImportCycles,
+// except through the filetests it skips, which go build ignores too: the
+// level of a package being visited is 0 for the packages importing it.
+func (g *precompileGraph) visit(dir string) int {
+	if level, ok := g.levels[dir]; ok {
+		return level
+	}
+	g.levels[dir] = 0
+	level := 0
+	for _, importedDir := range g.imports[dir] {
+		if importedLevel := g.visit(importedDir); importedLevel+1 > level {
+			level = importedLevel + 1
+		}
+	}
+	g.levels[dir] = level
+	return level
+}
+
+// pkgFiles returns the .gno files of the package in dir: the precompiled ones
+// for a root.
+func (g *precompileGraph) pkgFiles(dir string) []string {
+	if files, isRoot := g.roots[dir]; isRoot {
+		return files
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.gno"))
+	return files
+}
+
+// parsePkgFile parses the imports of the .gno file. The files that don't
+// parse are skipped by the graph: their errors are reported when they are
+// precompiled.
+func parsePkgFile(file string) (*ast.File, error) {
+	return parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+}
+
+// pkgImports returns the packages imported by the .gno files of dir, once
+// their imports are rewritten.
+func (g *precompileGraph) pkgImports(dir string) []pkgImport {
+	var imports []pkgImport
+	seen := map[importPath]bool{}
+	for _, file := range g.pkgFiles(dir) {
+		f, err := parsePkgFile(file)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			gnoPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			spec.Path.Value = strconv.Quote(g.rules.Rewrite(gnoPath))
+			for _, imported := range GetPathsFromImportSpec(g.rootDir, []*ast.ImportSpec{spec}) {
+				if !seen[imported] {
+					seen[imported] = true
+					imports = append(imports, pkgImport{gnoPath: gnoPath, path: imported})
+				}
+			}
+		}
+	}
+	return imports
+}
+
+// memPackage returns the package in dir, as checked by
+// gno.CheckImportCycles: its path is the gno path it is imported with, or,
+// for a root, the one of its directory in the examples of the repository.
+func (g *precompileGraph) memPackage(dir string) *std.MemPackage {
+	gnoPath, ok := g.gnoPaths[dir]
+	if !ok {
+		gnoPath = g.rootGnoPath(dir)
+	}
+	mempkg := &std.MemPackage{Path: gnoPath}
+	for _, file := range g.pkgFiles(dir) {
+		if _, err := parsePkgFile(file); err != nil {
+			continue
+		}
+		body, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		mempkg.Files = append(mempkg.Files, &std.MemFile{Name: filepath.Base(file), Body: string(body)})
+	}
+	return mempkg
+}
+
+// rootGnoPath returns the gno path of the package in dir, relative to the
+// examples of the repository at rootDir, or its slash-separated absolute
+// directory if it is not one of them.
+func (g *precompileGraph) rootGnoPath(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	examplesDir, err := filepath.Abs(filepath.Join(g.rootDir, "examples"))
+	if err != nil {
+		return filepath.ToSlash(absDir)
+	}
+	rel, err := filepath.Rel(examplesDir, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(absDir)
+	}
+	return filepath.ToSlash(rel)
+}
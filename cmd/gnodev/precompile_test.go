@@ -1,6 +1,23 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gnolang/gno/pkgs/commands"
+	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+)
 
 func TestPrecompileApp(t *testing.T) {
 	tc := []testMainCase{
@@ -16,3 +33,664 @@ func TestPrecompileApp(t *testing.T) {
 	}
 	testMainCaseRun(t, tc)
 }
+
+func TestPrecompileFileCache(t *testing.T) {
+	srcDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	srcPath := filepath.Join(srcDir, "foo.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n\nfunc Foo() string { return \"foo\" }\n"), 0o644)
+	require.NoError(t, err)
+
+	opts := newPrecompileOptions(&precompileCfg{
+		output:   ".",
+		cacheDir: cacheDir,
+	}, nil)
+
+	// first run: translate and populate the cache.
+	targetPath, err := precompileFile(srcPath, opts)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(srcDir, "foo.gno.gen.go"), targetPath)
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// tamper with the cache entry: if the second run translates the source
+	// again, the marker won't be found in the output.
+	cachePath := filepath.Join(cacheDir, entries[0].Name())
+	cached, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	marked := append(cached, []byte("\n// cached\n")...)
+	require.NoError(t, os.WriteFile(cachePath, marked, 0o644))
+
+	// second run: reuse the cache.
+	_, err = precompileFile(srcPath, opts)
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(srcDir, "foo.gno.gen.go"))
+	require.NoError(t, err)
+	require.Equal(t, string(marked), string(got))
+
+	// changing the source invalidates the entry.
+	err = os.WriteFile(srcPath, []byte("package foo\n\nfunc Bar() string { return \"bar\" }\n"), 0o644)
+	require.NoError(t, err)
+	_, err = precompileFile(srcPath, opts)
+	require.NoError(t, err)
+	got, err = os.ReadFile(filepath.Join(srcDir, "foo.gno.gen.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(got), "func Bar()")
+	entries, err = os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestPrecompileFileCacheDiagnostics(t *testing.T) {
+	srcDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	// std.TestSetOrigCaller is only defined by the gno tests.
+	srcPath := filepath.Join(srcDir, "foo_test.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n\nimport \"std\"\n\nfunc init() { std.TestSetOrigCaller(\"\") }\n"), 0o644)
+	require.NoError(t, err)
+
+	// the warnings are reported on each run, not only the first one.
+	cfg := &precompileCfg{output: ".", cacheDir: cacheDir, skipFmt: true, jobs: 1, outputFormat: outputFormatJSON}
+	for run := 0; run < 2; run++ {
+		mockOut := bytes.NewBufferString("")
+		io := commands.NewTestIO()
+		io.SetOut(commands.WriteNopCloser(mockOut))
+		err = execPrecompile(context.Background(), cfg, []string{srcPath}, io)
+		require.NoError(t, err)
+		require.Contains(t, mockOut.String(), "std.TestSetOrigCaller has no equivalent", "run %d", run)
+	}
+}
+
+func TestPrecompileFileVerbose(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "foo.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	for _, verbose := range []bool{false, true} {
+		mockOut := bytes.NewBufferString("")
+		mockErr := bytes.NewBufferString("")
+		io := commands.NewTestIO()
+		io.SetOut(commands.WriteNopCloser(mockOut))
+		io.SetErr(commands.WriteNopCloser(mockErr))
+
+		opts := newPrecompileOptions(&precompileCfg{
+			verbose: verbose,
+			output:  ".",
+		}, io)
+		_, err = precompileFile(srcPath, opts)
+		require.NoError(t, err)
+
+		require.Empty(t, mockOut.String())
+		if verbose {
+			require.Equal(t, srcPath+"\n", mockErr.String())
+		} else {
+			require.Empty(t, mockErr.String())
+		}
+	}
+}
+
+func TestPrecompileFileVet(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "foo.gno")
+	// gofmt accepts this file, but go vet reports the self-assignment.
+	err := os.WriteFile(srcPath, []byte("package foo\n\nfunc Foo() int {\n\tx := 1\n\tx = x\n\treturn x\n}\n"), 0o644)
+	require.NoError(t, err)
+
+	opts := newPrecompileOptions(&precompileCfg{output: "."}, nil)
+	_, err = precompileFile(srcPath, opts)
+	require.NoError(t, err)
+
+	opts = newPrecompileOptions(&precompileCfg{output: ".", vet: true}, nil)
+	_, err = precompileFile(srcPath, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "self-assignment of x")
+}
+
+func TestPrecompileGobuild(t *testing.T) {
+	srcDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(srcDir, "go.mod"), []byte("module example.com/foo\n"), 0o644)
+	require.NoError(t, err)
+	// foo.gno references bar.gno, so the files only build as a package.
+	err = os.WriteFile(filepath.Join(srcDir, "foo.gno"), []byte("package foo\n\nfunc Foo() int { return bar() }\n"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "bar.gno"), []byte("package foo\n\nfunc bar() int { return 1 }\n"), 0o644)
+	require.NoError(t, err)
+
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(mockErr))
+
+	// gobuild implies the fmt check.
+	cfg := &precompileCfg{output: ".", skipFmt: true, gobuild: true, goBinary: "go", jobs: 2}
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.NoError(t, err)
+	require.Empty(t, mockErr.String())
+
+	err = os.WriteFile(filepath.Join(srcDir, "bar.gno"), []byte("package foo\n\nfunc bar() string { return \"\" }\n"), 0o644)
+	require.NoError(t, err)
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	// the package is built, and its errors reported, only once.
+	require.EqualError(t, err, "1 precompile errors")
+	require.Contains(t, mockErr.String(), filepath.Join(srcDir, "bar.gno")+": build: ")
+	require.Contains(t, mockErr.String(), "cannot use bar()")
+}
+
+func TestPrecompileGobuildTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the looping go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	err := os.WriteFile(goBinary, []byte("#!/bin/sh\nwhile :; do :; done\n"), 0o755)
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(srcDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(mockErr))
+
+	cfg := &precompileCfg{output: ".", gobuild: true, goBinary: goBinary, runTimeout: 100 * time.Millisecond, jobs: 1}
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.EqualError(t, err, "1 precompile errors")
+	require.Equal(t, filepath.Join(srcDir, "foo.gno")+": build: go toolchain timed out\n", mockErr.String())
+}
+
+func TestPrecompileGoNotFound(t *testing.T) {
+	srcDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(srcDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	// nothing is precompiled without a go toolchain to build with.
+	cfg := &precompileCfg{output: ".", gobuild: true, goBinary: "gno-test-no-such-go"}
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, commands.NewTestIO())
+	require.ErrorIs(t, err, gno.ErrGoNotFound)
+	require.ErrorContains(t, err, "set --go-binary or install Go")
+	require.NoFileExists(t, filepath.Join(srcDir, "foo.gno.gen.go"))
+}
+
+func TestPrecompileOutputMirrorsRootDir(t *testing.T) {
+	rootDir := t.TempDir()
+	outDir := t.TempDir()
+	for _, pkg := range []string{"foo", "bar"} {
+		srcPath := filepath.Join(rootDir, "r", pkg, "a.gno")
+		err := WriteDirFile(srcPath, []byte("package "+pkg+"\n"))
+		require.NoError(t, err)
+	}
+
+	cfg := &precompileCfg{output: outDir, rootDir: rootDir, skipFmt: true, jobs: 1}
+	err := execPrecompile(context.Background(), cfg, []string{rootDir}, commands.NewTestIO())
+	require.NoError(t, err)
+
+	for _, pkg := range []string{"foo", "bar"} {
+		translated, err := os.ReadFile(filepath.Join(outDir, "r", pkg, "a.gno.gen.go"))
+		require.NoError(t, err)
+		require.Contains(t, string(translated), "package "+pkg+"\n")
+	}
+
+	// packages outside of the root dir mirror their absolute path.
+	path, err := ResolvePath(outDir, filepath.Join(rootDir, "r"), importPath(outDir))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(outDir, outDir), path)
+}
+
+func TestPrecompileOutputEmbeddedFiles(t *testing.T) {
+	rootDir := t.TempDir()
+	outDir := t.TempDir()
+	pkgDir := filepath.Join(rootDir, "r", "foo")
+	files := map[string]string{
+		"foo.gno":            "package foo\n\n//go:embed static\nvar Static string\n",
+		"static/hello.txt":   "hello world\n",
+		"static/.hidden.txt": "hidden\n",
+		"other.txt":          "not embedded\n",
+	}
+	for name, content := range files {
+		err := WriteDirFile(filepath.Join(pkgDir, name), []byte(content))
+		require.NoError(t, err)
+	}
+
+	cfg := &precompileCfg{output: outDir, rootDir: rootDir, skipFmt: true, jobs: 1}
+	err := execPrecompile(context.Background(), cfg, []string{rootDir}, commands.NewTestIO())
+	require.NoError(t, err)
+
+	outPkgDir := filepath.Join(outDir, "r", "foo")
+	require.FileExists(t, filepath.Join(outPkgDir, "foo.gno.gen.go"))
+	content, err := os.ReadFile(filepath.Join(outPkgDir, "static", "hello.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello world\n", string(content))
+	require.NoFileExists(t, filepath.Join(outPkgDir, "static", ".hidden.txt"))
+	require.NoFileExists(t, filepath.Join(outPkgDir, "other.txt"))
+}
+
+func TestParseRewriteRules(t *testing.T) {
+	rules, err := parseRewriteRules("std=example.com/stdshim, gno.land/r/=example.com/r/")
+	require.NoError(t, err)
+	require.Equal(t, gno.RewriteRules{
+		{Before: "std", After: "example.com/stdshim"},
+		{Before: "gno.land/r/", After: "example.com/r/"},
+	}, rules)
+
+	_, err = parseRewriteRules("std")
+	require.EqualError(t, err, `invalid rule "std", expected before=after`)
+
+	_, err = parseRewriteRules("gno.land/=a/,gno.land/r/=b/")
+	require.EqualError(t, err, `rewrite rules "gno.land/" and "gno.land/r/" overlap`)
+}
+
+func TestPrecompileFileDryRun(t *testing.T) {
+	srcDir := t.TempDir()
+	cacheDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "foo.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	mockOut := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetOut(commands.WriteNopCloser(mockOut))
+
+	opts := newPrecompileOptions(&precompileCfg{
+		output:   ".",
+		cacheDir: cacheDir,
+		dryRun:   true,
+	}, io)
+	_, err = precompileFile(srcPath, opts)
+	require.NoError(t, err)
+
+	targetPath := filepath.Join(srcDir, "foo.gno.gen.go")
+	require.Equal(t, srcPath+" -> "+targetPath+"\n", mockOut.String())
+	require.NoFileExists(t, targetPath)
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// errors are reported the same way as in a real run.
+	err = os.WriteFile(srcPath, []byte("package foo\nimport \"reflect\"\n"), 0o644)
+	require.NoError(t, err)
+	_, err = precompileFile(srcPath, opts)
+	require.EqualError(t, err, `import "reflect" is not in the whitelist`)
+}
+
+func TestPrecompilePkgContext(t *testing.T) {
+	srcDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(srcDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := newPrecompileOptions(&precompileCfg{output: "."}, nil)
+	err = precompilePkgContext(ctx, importPath(srcDir), opts)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoFileExists(t, filepath.Join(srcDir, "foo.gno.gen.go"))
+}
+
+// cancelWriter cancels its context once the output written to it contains
+// substr.
+type cancelWriter struct {
+	substr string
+	cancel context.CancelFunc
+	out    strings.Builder
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.out.Write(p)
+	if strings.Contains(w.out.String(), w.substr) {
+		w.cancel()
+	}
+	return len(p), nil
+}
+
+func TestPrecompilePkgContextImports(t *testing.T) {
+	rootDir := t.TempDir()
+	fooDir := filepath.Join(rootDir, "examples", "gno.land", "r", "demo", "foo")
+	barDir := filepath.Join(rootDir, "examples", "gno.land", "p", "demo", "bar")
+	err := WriteDirFile(filepath.Join(fooDir, "foo.gno"), []byte("package foo\n\nimport _ \"gno.land/p/demo/bar\"\n"))
+	require.NoError(t, err)
+	for _, name := range []string{"a.gno", "b.gno"} {
+		err := WriteDirFile(filepath.Join(barDir, name), []byte("package bar\n"))
+		require.NoError(t, err)
+	}
+
+	// the cancellation while the imported package is precompiled is
+	// returned.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errOut := &cancelWriter{substr: filepath.Join(barDir, "a.gno"), cancel: cancel}
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(errOut))
+	opts := newPrecompileOptions(&precompileCfg{output: ".", rootDir: rootDir, dryRun: true, verbose: true}, io)
+	err = precompilePkgContext(ctx, importPath(fooDir), opts)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotContains(t, errOut.out.String(), filepath.Join(barDir, "b.gno"))
+
+	// so are the errors of the imported package.
+	err = os.WriteFile(filepath.Join(barDir, "b.gno"), []byte("package bar\nimport \"reflect\"\n"), 0o644)
+	require.NoError(t, err)
+	opts = newPrecompileOptions(&precompileCfg{output: ".", rootDir: rootDir, dryRun: true}, nil)
+	err = precompilePkgContext(context.Background(), importPath(fooDir), opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(barDir, "b.gno")+`: import "reflect" is not in the whitelist`)
+}
+
+func TestPrecompilePkgAllErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(srcDir, "bar.gno"), []byte("package foo\nimport \"reflect\"\n"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "baz.gno"), []byte("package foo\nfunc {\n"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	opts := newPrecompileOptions(&precompileCfg{output: "."}, nil)
+	err = precompilePkg(importPath(srcDir), opts)
+	require.Error(t, err)
+	errs := multierr.Errors(err)
+	require.Len(t, errs, 2)
+	require.EqualError(t, errs[0], filepath.Join(srcDir, "bar.gno")+`: import "reflect" is not in the whitelist`)
+	require.ErrorContains(t, errs[1], filepath.Join(srcDir, "baz.gno")+": parse: ")
+
+	// the valid files are still precompiled.
+	require.FileExists(t, filepath.Join(srcDir, "foo.gno.gen.go"))
+}
+
+func TestPrecompileParallel(t *testing.T) {
+	srcDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		source := "package foo\n"
+		if i%5 == 0 {
+			source = "package foo\nimport \"reflect\"\n"
+		}
+		err := os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("file%02d.gno", i)), []byte(source), 0o644)
+		require.NoError(t, err)
+	}
+
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(mockErr))
+
+	cfg := &precompileCfg{output: ".", skipFmt: true, jobs: 8}
+	err := execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.EqualError(t, err, "4 precompile errors")
+
+	var expected string
+	for _, i := range []int{0, 5, 10, 15} {
+		expected += fmt.Sprintf("%s: precompile: import \"reflect\" is not in the whitelist\n", filepath.Join(srcDir, fmt.Sprintf("file%02d.gno", i)))
+	}
+	require.Equal(t, expected, mockErr.String())
+
+	for i := 0; i < 20; i++ {
+		target := filepath.Join(srcDir, fmt.Sprintf("file%02d.gno.gen.go", i))
+		if i%5 == 0 {
+			require.NoFileExists(t, target)
+		} else {
+			require.FileExists(t, target)
+		}
+	}
+}
+
+func TestPrecompileOutputFormatJSON(t *testing.T) {
+	srcDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(srcDir, "a.gno"), []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(srcDir, "b.gno"), []byte("package foo\n\nimport \"reflect\"\n"), 0o644)
+	require.NoError(t, err)
+
+	mockOut := bytes.NewBufferString("")
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetOut(commands.WriteNopCloser(mockOut))
+	io.SetErr(commands.WriteNopCloser(mockErr))
+
+	cfg := &precompileCfg{output: ".", outputFormat: "json", jobs: 2}
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.EqualError(t, err, "1 precompile errors")
+	require.Empty(t, mockErr.String())
+
+	var report gno.PrecompileReport
+	require.NoError(t, json.Unmarshal(mockOut.Bytes(), &report))
+	require.Len(t, report.Files, 2)
+
+	a := report.Files[0]
+	require.Equal(t, filepath.Join(srcDir, "a.gno"), a.SourcePath)
+	require.Equal(t, filepath.Join(srcDir, "a.gno.gen.go"), a.TargetPath)
+	require.True(t, a.Written)
+	require.Empty(t, a.Error)
+
+	b := report.Files[1]
+	require.Equal(t, filepath.Join(srcDir, "b.gno"), b.SourcePath)
+	require.False(t, b.Written)
+	require.Equal(t, `import "reflect" is not in the whitelist`, b.Error)
+	require.Len(t, b.Diagnostics, 1)
+	require.Equal(t, 3, b.Diagnostics[0].Pos.Line)
+
+	cfg.outputFormat = "xml"
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.EqualError(t, err, `invalid output format "xml"`)
+}
+
+func TestPrecompileStdin(t *testing.T) {
+	mockOut := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetIn(strings.NewReader("package foo\n\nimport \"std\"\n\nvar _ = std.GetHeight\n"))
+	io.SetOut(commands.WriteNopCloser(mockOut))
+
+	err := execPrecompile(context.Background(), &precompileCfg{}, []string{"-"}, io)
+	require.NoError(t, err)
+	require.Equal(t, gno.GeneratedHeader+`
+
+//go:build gno
+// +build gno
+
+package foo
+
+import "github.com/gnolang/gno/stdlibs/stdshim"
+
+var _ = std.GetHeight
+`, mockOut.String())
+
+	// the imports made unused by the translation are pruned, as for the
+	// files.
+	mockOut.Reset()
+	io.SetIn(strings.NewReader("package foo\n\nimport \"std\"\n\nfunc Foo() string {\n\tstd := \"std\"\n\treturn std\n}\n"))
+	err = execPrecompile(context.Background(), &precompileCfg{}, []string{"-"}, io)
+	require.NoError(t, err)
+	require.NotContains(t, mockOut.String(), "stdshim")
+
+	io.SetIn(strings.NewReader("package foo\n\nimport \"reflect\"\n"))
+	err = execPrecompile(context.Background(), &precompileCfg{}, []string{"-"}, io)
+	require.EqualError(t, err, `stdin.gno: precompile: import "reflect" is not in the whitelist`)
+}
+
+func TestPrecompileOptionsConcurrentAccess(t *testing.T) {
+	opts := newPrecompileOptions(&precompileCfg{}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				pkg := importPath(fmt.Sprintf("pkg%d", (i+j)%20))
+				opts.markAsPrecompiled(pkg)
+				if !opts.isPrecompiled(pkg) {
+					t.Errorf("%s should be marked as precompiled", pkg)
+				}
+				opts.isPrecompiled(importPath(fmt.Sprintf("other%d", j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		require.True(t, opts.isPrecompiled(importPath(fmt.Sprintf("pkg%d", i))))
+	}
+}
+
+func TestPrecompileFileTargetPath(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	require.NoError(t, os.Chdir(srcDir))
+	defer os.Chdir(wd)
+
+	err = os.WriteFile("foo_test.gno", []byte("package foo\n"), 0o644)
+	require.NoError(t, err)
+
+	opts := newPrecompileOptions(&precompileCfg{output: "."}, nil)
+	targetPath, err := precompileFile("foo_test.gno", opts)
+	require.NoError(t, err)
+	require.True(t, filepath.IsAbs(targetPath))
+	require.Equal(t, ".foo_test.gno.gen_test.go", filepath.Base(targetPath))
+	require.FileExists(t, targetPath)
+}
+
+func TestPrecompileImportOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the logging go binary is a shell script")
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	tmpDir := t.TempDir()
+	require.NoError(t, os.Chdir(tmpDir))
+	defer os.Chdir(wd)
+
+	// a diamond: a imports b and c, which both import d.
+	for name, imports := range map[string][]string{
+		"a": {"b", "c"},
+		"b": {"d"},
+		"c": {"d"},
+		"d": nil,
+	} {
+		source := "package " + name + "\n\n"
+		for _, imported := range imports {
+			source += fmt.Sprintf("import _ %q\n", "gno.land/p/demo/"+imported)
+		}
+		err := WriteDirFile(filepath.Join("examples", "gno.land", "p", "demo", name, name+".gno"), []byte(source))
+		require.NoError(t, err)
+	}
+
+	// the fake go binary logs the packages it builds.
+	buildLog := filepath.Join(tmpDir, "build.log")
+	goBinary := filepath.Join(tmpDir, "go")
+	script := fmt.Sprintf("#!/bin/sh\n[ \"$1\" = build ] || exit 1\nbasename \"$4\" >> %q\n", buildLog)
+	err = os.WriteFile(goBinary, []byte(script), 0o755)
+	require.NoError(t, err)
+
+	cfg := &precompileCfg{output: ".", rootDir: ".", gobuild: true, goBinary: goBinary, jobs: 4}
+	err = execPrecompile(context.Background(), cfg, []string{filepath.Join("examples", "gno.land", "p", "demo", "a")}, commands.NewTestIO())
+	require.NoError(t, err)
+
+	out, err := os.ReadFile(buildLog)
+	require.NoError(t, err)
+	built := strings.Fields(string(out))
+	require.Len(t, built, 4)
+	require.Equal(t, "d", built[0])
+	require.ElementsMatch(t, []string{"b", "c"}, built[1:3])
+	require.Equal(t, "a", built[3])
+
+	// close the cycle d -> a -> b -> d.
+	err = os.WriteFile(filepath.Join("examples", "gno.land", "p", "demo", "d", "d.gno"), []byte("package d\n\nimport _ \"gno.land/p/demo/a\"\n"), 0o644)
+	require.NoError(t, err)
+	err = execPrecompile(context.Background(), cfg, []string{filepath.Join("examples", "gno.land", "p", "demo", "a")}, commands.NewTestIO())
+	require.EqualError(t, err, "import cycle once rewritten: gno.land/p/demo/a -> gno.land/p/demo/b -> gno.land/p/demo/d -> gno.land/p/demo/a")
+}
+
+func TestPrecompileImportCollision(t *testing.T) {
+	rootDir := t.TempDir()
+	err := WriteDirFile(filepath.Join(rootDir, "examples", "gno.land", "r", "demo", "foo", "foo.gno"), []byte("package foo\n\nimport _ \"gno.land/p/demo/foo\"\n"))
+	require.NoError(t, err)
+	err = WriteDirFile(filepath.Join(rootDir, "examples", "gno.land", "p", "demo", "foo", "foo.gno"), []byte("package foo\n"))
+	require.NoError(t, err)
+
+	// the realm is rewritten to the package it imports.
+	cfg := &precompileCfg{
+		output:       ".",
+		rootDir:      rootDir,
+		skipFmt:      true,
+		jobs:         1,
+		rewriteRules: "gno.land/p/demo/=github.com/gnolang/gno/examples/gno.land/p/demo/,gno.land/r/demo/=github.com/gnolang/gno/examples/gno.land/p/demo/",
+	}
+	err = execPrecompile(context.Background(), cfg, []string{filepath.Join(rootDir, "examples", "gno.land", "r", "demo", "foo")}, commands.NewTestIO())
+	var cycleErr *gno.ImportCycleError
+	require.ErrorAs(t, err, &cycleErr)
+	require.EqualError(t, err, "import cycle once rewritten: gno.land/r/demo/foo -> gno.land/p/demo/foo "+
+		"(gno.land/p/demo/foo, gno.land/r/demo/foo are all rewritten to github.com/gnolang/gno/examples/gno.land/p/demo/foo)")
+}
+
+func TestPrecompilePkgPathSpellings(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	tmpDir := t.TempDir()
+	require.NoError(t, os.Chdir(tmpDir))
+	defer os.Chdir(wd)
+
+	err = WriteDirFile(filepath.Join("pkgs", "foo", "foo.gno"), []byte("package foo\n"))
+	require.NoError(t, err)
+
+	// the relative, unclean and absolute paths of the package are the same
+	// package, precompiled once.
+	opts := newPrecompileOptions(&precompileCfg{output: "."}, nil)
+	absDir, err := filepath.Abs(filepath.Join("pkgs", "foo"))
+	require.NoError(t, err)
+	for _, path := range []string{
+		filepath.Join("pkgs", "foo"),
+		"." + string(filepath.Separator) + filepath.Join("pkgs", "bar", "..", "foo"),
+		absDir,
+	} {
+		require.NoError(t, precompilePkg(importPath(path), opts))
+		require.True(t, opts.isPrecompiled(importPath(path)), path)
+	}
+	require.Len(t, opts.report.Files, 1)
+}
+
+func TestPrecompileTimings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	err := os.WriteFile(goBinary, []byte("#!/bin/sh\n[ \"$1\" = build ] || exit 1\nsleep 0.01\n"), 0o755)
+	require.NoError(t, err)
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.gno", "b.gno"} {
+		err := os.WriteFile(filepath.Join(srcDir, name), []byte("package foo\n\nvar _ = 1\n"), 0o644)
+		require.NoError(t, err)
+	}
+
+	opts := newPrecompileOptions(&precompileCfg{output: ".", gobuild: true, goBinary: goBinary}, nil)
+	require.NoError(t, precompilePkg(importPath(srcDir), opts))
+	require.Len(t, opts.timings, 1)
+	timings := *opts.timings[srcDir]
+	require.Equal(t, 2, timings.files)
+	require.Positive(t, timings.Parse)
+	require.Positive(t, timings.Translate)
+	require.Positive(t, timings.Verify)
+	require.GreaterOrEqual(t, timings.Build, 10*time.Millisecond)
+	require.Equal(t, timings.Parse+timings.Translate+timings.Verify+timings.Build, timings.Total())
+
+	// the timings of the package only grow.
+	_, err = precompileFile(filepath.Join(srcDir, "a.gno"), opts)
+	require.NoError(t, err)
+	again := *opts.timings[srcDir]
+	require.Equal(t, 3, again.files)
+	require.Greater(t, again.Parse, timings.Parse)
+	require.Greater(t, again.Translate, timings.Translate)
+	require.Greater(t, again.Verify, timings.Verify)
+	require.Equal(t, timings.Build, again.Build)
+
+	// they are printed in verbose mode.
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(mockErr))
+	cfg := &precompileCfg{output: ".", verbose: true, gobuild: true, goBinary: goBinary}
+	err = execPrecompile(context.Background(), cfg, []string{srcDir}, io)
+	require.NoError(t, err)
+	require.Contains(t, mockErr.String(), srcDir+": 2 files in ")
+	require.Contains(t, mockErr.String(), "total: 2 files in ")
+}
@@ -2,7 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"go/token"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/gnolang/gno/pkgs/commands"
 	gno "github.com/gnolang/gno/pkgs/gnolang"
@@ -10,8 +17,10 @@ import (
 )
 
 type runCfg struct {
-	verbose bool
-	rootDir string
+	verbose      bool
+	rootDir      string
+	entrypoint   string
+	includeTests bool
 }
 
 func newRunCmd(io *commands.IO) *commands.Command {
@@ -20,8 +29,9 @@ func newRunCmd(io *commands.IO) *commands.Command {
 	return commands.NewCommand(
 		commands.Metadata{
 			Name:       "run",
-			ShortUsage: "run [flags] <file> [<file>...]",
+			ShortUsage: "run [flags] <file or dir> [<file or dir>...] [<arg>...]",
 			ShortHelp:  "Runs the specified gno files",
+			LongHelp:   "Runs the main function of the specified gno files, or the -entrypoint function called with the arguments following the files. Directories are walked recursively for .gno files, which must all belong to the same package.",
 		},
 		cfg,
 		func(_ context.Context, args []string) error {
@@ -44,6 +54,20 @@ func (c *runCfg) RegisterFlags(fs *flag.FlagSet) {
 		"",
 		"clone location of github.com/gnolang/gno (gnodev tries to guess it)",
 	)
+
+	fs.StringVar(
+		&c.entrypoint,
+		"entrypoint",
+		"",
+		"exported function to call instead of main, with the arguments following the files",
+	)
+
+	fs.BoolVar(
+		&c.includeTests,
+		"include-tests",
+		false,
+		"include the _test.gno files found in directories",
+	)
 }
 
 func execRun(cfg *runCfg, args []string, io *commands.IO) error {
@@ -73,15 +97,187 @@ func execRun(cfg *runCfg, args []string, io *commands.IO) error {
 		Store:   testStore,
 	})
 
+	// the arguments of the entrypoint follow the files.
+	fnames, fargs := args, []string(nil)
+	if cfg.entrypoint != "" {
+		for i, arg := range args {
+			if !strings.HasSuffix(arg, ".gno") && !isDir(arg) {
+				fnames, fargs = args[:i], args[i:]
+				break
+			}
+		}
+	}
+
+	fnames, err := runFilesFromArgs(fnames, cfg.includeTests)
+	if err != nil {
+		return err
+	}
+
 	// read files
-	files := make([]*gno.FileNode, len(args))
-	for i, fname := range args {
+	files := make([]*gno.FileNode, len(fnames))
+	for i, fname := range fnames {
+		if cfg.verbose {
+			io.ErrPrintfln("including %s", fname)
+		}
 		files[i] = gno.MustReadFile(fname)
 	}
+	if err = checkSinglePackage(fnames, files); err != nil {
+		return err
+	}
 
 	// run files
 	m.RunFiles(files...)
-	m.RunMain()
+	if cfg.entrypoint == "" {
+		m.RunMain()
+		return nil
+	}
+
+	call, err := entrypointCall(testStore, cfg.entrypoint, fargs)
+	if err != nil {
+		return err
+	}
+	for _, res := range m.Eval(call) {
+		io.Println(res.String())
+	}
+	return nil
+}
+
+// runFilesFromArgs expands the directories in args to the .gno files they
+// contain. _filetest.gno files are always skipped, as they are standalone
+// programs, and _test.gno files are skipped unless includeTests is set. A
+// file given several times, e.g. both on its own and through its directory,
+// is only included once.
+func runFilesFromArgs(args []string, includeTests bool) ([]string, error) {
+	fnames := []string{}
+	seen := map[string]bool{}
+	addFile := func(fname string) {
+		if !seen[filepath.Clean(fname)] {
+			seen[filepath.Clean(fname)] = true
+			fnames = append(fnames, fname)
+		}
+	}
+	for _, arg := range args {
+		if !isDir(arg) {
+			addFile(arg)
+			continue
+		}
+
+		paths, err := GnoFilesFromArgs([]string{arg}, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			switch {
+			case strings.HasSuffix(path, "_filetest.gno"):
+				continue
+			case strings.HasSuffix(path, "_test.gno") && !includeTests:
+				continue
+			}
+			addFile(path)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no .gno files found in %s", arg)
+		}
+	}
+	return fnames, nil
+}
 
+// checkSinglePackage returns an error if files declare different packages.
+func checkSinglePackage(fnames []string, files []*gno.FileNode) error {
+	for i, file := range files {
+		if file.PkgName != files[0].PkgName {
+			return fmt.Errorf("found multiple packages: %s (%s) and %s (%s)",
+				files[0].PkgName, fnames[0], file.PkgName, fnames[i])
+		}
+	}
 	return nil
 }
+
+// entrypointCall returns the call to the entrypoint function of the main
+// package, with the given arguments parsed according to its parameter types.
+func entrypointCall(store gno.Store, entrypoint string, args []string) (gno.Expr, error) {
+	if !token.IsExported(entrypoint) {
+		return nil, fmt.Errorf("entrypoint %s is not exported", entrypoint)
+	}
+	pn := store.GetBlockNode(gno.PackageNodeLocation("main")).(*gno.PackageNode)
+	if _, ok := pn.GetLocalIndex(gno.Name(entrypoint)); !ok {
+		return nil, fmt.Errorf("entrypoint %s not found", entrypoint)
+	}
+	ft, ok := pn.GetStaticTypeOf(store, gno.Name(entrypoint)).(*gno.FuncType)
+	if !ok {
+		return nil, fmt.Errorf("entrypoint %s is not a function", entrypoint)
+	}
+
+	if len(args) != len(ft.Params) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", entrypoint, len(ft.Params), len(args))
+	}
+	argExprs := make([]string, len(args))
+	for i, arg := range args {
+		argExpr, err := entrypointArg(ft.Params[i].Type, arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %w", i+1, entrypoint, err)
+		}
+		argExprs[i] = argExpr
+	}
+
+	return gno.ParseExpr(entrypoint + "(" + strings.Join(argExprs, ", ") + ")")
+}
+
+// entrypointArg returns the expression of arg, converted to the primitive
+// type of a parameter. The expression is formatted from the parsed value, so
+// that the inputs accepted by strconv, e.g. "t" or "+1", make valid gno.
+func entrypointArg(typ gno.Type, arg string) (string, error) {
+	pt, ok := typ.(gno.PrimitiveType)
+	if !ok {
+		return "", fmt.Errorf("unsupported parameter type %s", typ.String())
+	}
+
+	var (
+		value string
+		err   error
+	)
+	switch pt {
+	case gno.StringType:
+		return strconv.Quote(arg), nil
+	case gno.BoolType:
+		var b bool
+		b, err = strconv.ParseBool(arg)
+		value = strconv.FormatBool(b)
+	case gno.IntType, gno.Int8Type, gno.Int16Type, gno.Int32Type, gno.Int64Type:
+		var i int64
+		i, err = strconv.ParseInt(arg, 10, entrypointArgBitSize(pt))
+		value = strconv.FormatInt(i, 10)
+	case gno.UintType, gno.Uint8Type, gno.Uint16Type, gno.Uint32Type, gno.Uint64Type:
+		var u uint64
+		u, err = strconv.ParseUint(arg, 10, entrypointArgBitSize(pt))
+		value = strconv.FormatUint(u, 10)
+	case gno.Float32Type, gno.Float64Type:
+		var f float64
+		f, err = strconv.ParseFloat(arg, entrypointArgBitSize(pt))
+		if err == nil && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			err = errors.New("not finite")
+		}
+		value = strconv.FormatFloat(f, 'g', -1, entrypointArgBitSize(pt))
+	default:
+		return "", fmt.Errorf("unsupported parameter type %s", pt.String())
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q", pt.String(), arg)
+	}
+	return pt.String() + "(" + value + ")", nil
+}
+
+// entrypointArgBitSize returns the size in bits of the numeric type pt, as
+// expected by strconv; int and uint are 64 bits in gno.
+func entrypointArgBitSize(pt gno.PrimitiveType) int {
+	switch pt {
+	case gno.Int8Type, gno.Uint8Type:
+		return 8
+	case gno.Int16Type, gno.Uint16Type:
+		return 16
+	case gno.Int32Type, gno.Uint32Type, gno.Float32Type:
+		return 32
+	default:
+		return 64
+	}
+}
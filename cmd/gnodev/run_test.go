@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"github.com/stretchr/testify/require"
+)
 
 func TestRunApp(t *testing.T) {
 	tc := []testMainCase{
@@ -13,8 +18,33 @@ func TestRunApp(t *testing.T) {
 			stdoutShouldContain: "hello world!",
 		},
 		{
-			args:                 []string{"run", "../../tests/integ/run-main/"},
-			recoverShouldContain: "read ../../tests/integ/run-main/: is a directory", // FIXME: should work
+			args:                []string{"run", "../../tests/integ/run-main/"},
+			stdoutShouldContain: "hello world!",
+		},
+		{
+			args:                []string{"run", "../../tests/integ/run-dir"},
+			stdoutShouldContain: "hello from a directory!",
+		},
+		{
+			args:                []string{"run", "-verbose", "../../tests/integ/run-dir"},
+			stdoutShouldContain: "hello from a directory!",
+			stderrShouldContain: "including ../../tests/integ/run-dir/greeting.gno",
+		},
+		{
+			args:        []string{"run", "-entrypoint", "Included", "../../tests/integ/run-dir"},
+			errShouldBe: "entrypoint Included not found",
+		},
+		{
+			args:                []string{"run", "-include-tests", "-entrypoint", "Included", "../../tests/integ/run-dir"},
+			stdoutShouldContain: `("test file included" string)`,
+		},
+		{
+			args:        []string{"run", "../../tests/integ/run-multipkg"},
+			errShouldBe: "found multiple packages: main (../../tests/integ/run-multipkg/main.gno) and other (../../tests/integ/run-multipkg/other.gno)",
+		},
+		{
+			args:        []string{"run", "../../tests/integ/empty-dir"},
+			errShouldBe: "no .gno files found in ../../tests/integ/empty-dir",
 		},
 		{
 			args:                 []string{"run", "../../tests/integ/does-not-exist"},
@@ -24,7 +54,50 @@ func TestRunApp(t *testing.T) {
 			args:                 []string{"run", "../../tests/integ/run-namedpkg/main.gno"},
 			recoverShouldContain: "expected package name [main] but got [namedpkg]", // FIXME: should work
 		},
-		// TODO: multiple files
+		{
+			args:                []string{"run", "../../tests/integ/run-entrypoint/main.gno"},
+			stdoutShouldContain: "hello world!",
+		},
+		{
+			args:                []string{"run", "-entrypoint", "Greet", "../../tests/integ/run-entrypoint/main.gno", "gnome", "2"},
+			stdoutShouldContain: `("hello gnome!hello gnome!" string)`,
+		},
+		{
+			args:                []string{"run", "-entrypoint", "Ratio", "../../tests/integ/run-entrypoint/main.gno", "3", "4"},
+			stdoutShouldContain: "(0.75 float64)",
+		},
+		{
+			args:        []string{"run", "-entrypoint", "Greet", "../../tests/integ/run-entrypoint/main.gno", "gnome"},
+			errShouldBe: "Greet expects 2 arguments, got 1",
+		},
+		{
+			args:        []string{"run", "-entrypoint", "Greet", "../../tests/integ/run-entrypoint/main.gno", "gnome", "two"},
+			errShouldBe: `argument 2 of Greet: invalid int "two"`,
+		},
+		{
+			args:        []string{"run", "-entrypoint", "Sum", "../../tests/integ/run-entrypoint/main.gno", "1"},
+			errShouldBe: "argument 1 of Sum: unsupported parameter type []int",
+		},
+		{
+			args:        []string{"run", "-entrypoint", "Missing", "../../tests/integ/run-entrypoint/main.gno"},
+			errShouldBe: "entrypoint Missing not found",
+		},
+		{
+			args:        []string{"run", "-entrypoint", "unexported", "../../tests/integ/run-entrypoint/main.gno"},
+			errShouldBe: "entrypoint unexported is not exported",
+		},
+		{
+			args:                []string{"run", "../../tests/integ/run-dir/main.gno", "../../tests/integ/run-dir/greeting.gno"},
+			stdoutShouldContain: "hello from a directory!",
+		},
+		{
+			args:                []string{"run", "../../tests/integ/run-dir/greeting.gno", "../../tests/integ/run-dir"},
+			stdoutShouldContain: "hello from a directory!",
+		},
+		{
+			args:        []string{"run", "../../tests/integ/run-multipkg/main.gno", "../../tests/integ/run-multipkg/other.gno"},
+			errShouldBe: "found multiple packages: main (../../tests/integ/run-multipkg/main.gno) and other (../../tests/integ/run-multipkg/other.gno)",
+		},
 		// TODO: a test file
 		// TODO: a file without main
 		// TODO: args
@@ -35,3 +108,48 @@ func TestRunApp(t *testing.T) {
 	}
 	testMainCaseRun(t, tc)
 }
+
+func TestEntrypointArg(t *testing.T) {
+	cases := []struct {
+		typ      gno.Type
+		arg      string
+		expected string
+		err      string
+	}{
+		{typ: gno.StringType, arg: `say "hi"`, expected: `"say \"hi\""`},
+		{typ: gno.BoolType, arg: "true", expected: "bool(true)"},
+		{typ: gno.BoolType, arg: "1", expected: "bool(true)"},
+		{typ: gno.BoolType, arg: "t", expected: "bool(true)"},
+		{typ: gno.BoolType, arg: "FALSE", expected: "bool(false)"},
+		{typ: gno.BoolType, arg: "yes", err: `invalid bool "yes"`},
+		{typ: gno.IntType, arg: "-42", expected: "int(-42)"},
+		{typ: gno.IntType, arg: "+42", expected: "int(42)"},
+		{typ: gno.Int8Type, arg: "127", expected: "int8(127)"},
+		{typ: gno.Int8Type, arg: "300", err: `invalid int8 "300"`},
+		{typ: gno.Int16Type, arg: "-40000", err: `invalid int16 "-40000"`},
+		{typ: gno.Int32Type, arg: "3000000000", err: `invalid int32 "3000000000"`},
+		{typ: gno.Uint8Type, arg: "255", expected: "uint8(255)"},
+		{typ: gno.Uint8Type, arg: "256", err: `invalid uint8 "256"`},
+		{typ: gno.Uint8Type, arg: "-1", err: `invalid uint8 "-1"`},
+		{typ: gno.Uint64Type, arg: "18446744073709551615", expected: "uint64(18446744073709551615)"},
+		{typ: gno.Float64Type, arg: "0.75", expected: "float64(0.75)"},
+		{typ: gno.Float64Type, arg: "1e6", expected: "float64(1e+06)"},
+		{typ: gno.Float32Type, arg: "1e39", err: `invalid float32 "1e39"`},
+		{typ: gno.Float64Type, arg: "Inf", err: `invalid float64 "Inf"`},
+		{typ: gno.Float64Type, arg: "-inf", err: `invalid float64 "-inf"`},
+		{typ: gno.Float64Type, arg: "NaN", err: `invalid float64 "NaN"`},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.typ.String()+"/"+c.arg, func(t *testing.T) {
+			t.Parallel()
+			expr, err := entrypointArg(c.typ, c.arg)
+			if c.err != "" {
+				require.EqualError(t, err, c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, expr)
+		})
+	}
+}
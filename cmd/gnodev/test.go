@@ -29,6 +29,7 @@ type testCfg struct {
 	run               string
 	timeout           time.Duration
 	precompile        bool // TODO: precompile should be the default, but it needs to automatically precompile dependencies in memory.
+	keepGenerated     bool
 	updateGoldenTests bool
 }
 
@@ -42,8 +43,8 @@ func newTestCmd(io *commands.IO) *commands.Command {
 			ShortHelp:  "Runs the tests for the specified packages",
 		},
 		cfg,
-		func(_ context.Context, args []string) error {
-			return execTest(cfg, args, io)
+		func(ctx context.Context, args []string) error {
+			return execTest(ctx, cfg, args, io)
 		},
 	)
 }
@@ -63,6 +64,13 @@ func (c *testCfg) RegisterFlags(fs *flag.FlagSet) {
 		"precompile gno to go before testing",
 	)
 
+	fs.BoolVar(
+		&c.keepGenerated,
+		"keep-generated",
+		false,
+		"keep the precompiled .go files instead of removing them, and print their location",
+	)
+
 	fs.BoolVar(
 		&c.updateGoldenTests,
 		"update-golden-tests",
@@ -92,7 +100,7 @@ func (c *testCfg) RegisterFlags(fs *flag.FlagSet) {
 	)
 }
 
-func execTest(cfg *testCfg, args []string, io *commands.IO) error {
+func execTest(ctx context.Context, cfg *testCfg, args []string, io *commands.IO) error {
 	if len(args) < 1 {
 		return flag.ErrHelp
 	}
@@ -103,7 +111,13 @@ func execTest(cfg *testCfg, args []string, io *commands.IO) error {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer os.RemoveAll(tempdirRoot)
+	// keep the precompiled files, even on failure, if -keep-generated is
+	// set.
+	if cfg.keepGenerated {
+		io.ErrPrintfln("keeping the precompiled files in %s", tempdirRoot)
+	} else {
+		defer os.RemoveAll(tempdirRoot)
+	}
 
 	// go.mod
 	modPath := filepath.Join(tempdirRoot, "go.mod")
@@ -117,7 +131,7 @@ func execTest(cfg *testCfg, args []string, io *commands.IO) error {
 		cfg.rootDir = guessRootDir()
 	}
 
-	pkgPaths, err := gnoPackagesFromArgs(args)
+	pkgPaths, err := GnoPackagesFromArgs(args, true)
 	if err != nil {
 		return fmt.Errorf("list packages from args: %w", err)
 	}
@@ -137,9 +151,10 @@ func execTest(cfg *testCfg, args []string, io *commands.IO) error {
 				io.ErrPrintfln("=== PREC  %s", pkgPath)
 			}
 			precompileOpts := newPrecompileOptions(&precompileCfg{
-				output: tempdirRoot,
-			})
-			err := precompilePkg(importPath(pkgPath), precompileOpts)
+				output:  tempdirRoot,
+				rootDir: cfg.rootDir,
+			}, io)
+			err := precompilePkgContext(ctx, importPath(pkgPath), precompileOpts)
 			if err != nil {
 				io.ErrPrintln(err)
 				io.ErrPrintln("FAIL")
@@ -153,11 +168,11 @@ func execTest(cfg *testCfg, args []string, io *commands.IO) error {
 			if verbose {
 				io.ErrPrintfln("=== BUILD %s", pkgPath)
 			}
-			tempDir, err := ResolvePath(tempdirRoot, importPath(pkgPath))
+			tempDir, err := ResolvePath(tempdirRoot, cfg.rootDir, importPath(pkgPath))
 			if err != nil {
 				return errors.New("cannot resolve build dir")
 			}
-			err = goBuildFileOrPkg(tempDir, defaultBuildOptions)
+			err = goBuildFileOrPkg(ctx, tempDir, defaultBuildOptions, io)
 			if err != nil {
 				io.ErrPrintln(err)
 				io.ErrPrintln("FAIL")
@@ -1,6 +1,15 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/commands"
+	"github.com/stretchr/testify/require"
+)
 
 func TestTest(t *testing.T) {
 	tc := []testMainCase{
@@ -41,7 +50,7 @@ func TestTest(t *testing.T) {
 		}, {
 			args:                []string{"test", "--precompile", "../../tests/integ/empty-gno1"},
 			errShouldBe:         "FAIL: 1 build errors, 0 test errors",
-			stderrShouldContain: "../../tests/integ/empty-gno1/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'",
+			stderrShouldContain: "../../tests/integ/empty-gno1/empty.gno: parse: ../../tests/integ/empty-gno1/empty.gno:1:1: expected 'package', found 'EOF'",
 		}, {
 			args:            []string{"test", "../../tests/integ/empty-gno2"},
 			recoverShouldBe: "empty.gno:1:1: expected 'package', found 'EOF'",
@@ -49,7 +58,7 @@ func TestTest(t *testing.T) {
 			// FIXME: better error handling + rename dontcare.gno with actual test file
 			args:                []string{"test", "--precompile", "../../tests/integ/empty-gno2"},
 			errShouldContain:    "FAIL: 1 build errors, 0 test errors",
-			stderrShouldContain: "../../tests/integ/empty-gno2/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'",
+			stderrShouldContain: "../../tests/integ/empty-gno2/empty.gno: parse: ../../tests/integ/empty-gno2/empty.gno:1:1: expected 'package', found 'EOF'",
 		}, {
 			args:            []string{"test", "../../tests/integ/empty-gno3"},
 			recoverShouldBe: "../../tests/integ/empty-gno3/empty_filetest.gno:1:1: expected 'package', found 'EOF'",
@@ -57,7 +66,7 @@ func TestTest(t *testing.T) {
 			// FIXME: better error handling
 			args:                []string{"test", "--precompile", "../../tests/integ/empty-gno3"},
 			errShouldContain:    "FAIL: 1 build errors, 0 test errors",
-			stderrShouldContain: "../../tests/integ/empty-gno3/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'",
+			stderrShouldContain: "../../tests/integ/empty-gno3/empty.gno: parse: ../../tests/integ/empty-gno3/empty.gno:1:1: expected 'package', found 'EOF'",
 		}, {
 			args:                []string{"test", "--verbose", "../../tests/integ/failing1"},
 			errShouldBe:         "FAIL: 0 build errors, 1 test errors",
@@ -124,11 +133,11 @@ func TestTest(t *testing.T) {
 
 		// TODO: when 'gnodev test' will by default imply running precompile, we should use the following tests.
 		// {args: []string{"test", "../../tests/integ/empty-gno1", "--no-precompile"}, stderrShouldBe: "?       ./../../tests/integ/empty-gno1 \t[no test files]\n"},
-		// {args: []string{"test", "../../tests/integ/empty-gno1"}, errShouldBe: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno1/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'"},
+		// {args: []string{"test", "../../tests/integ/empty-gno1"}, errShouldBe: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno1/empty.gno: parse: ../../tests/integ/empty-gno1/empty.gno:1:1: expected 'package', found 'EOF'"},
 		// {args: []string{"test", "../../tests/integ/empty-gno2", "--no-precompile"}, recoverShouldBe: "empty.gno:1:1: expected 'package', found 'EOF'"}, // FIXME: better error handling + rename dontcare.gno with actual test file
-		// {args: []string{"test", "../../tests/integ/empty-gno2"}, errShouldContain: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno2/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'"},
+		// {args: []string{"test", "../../tests/integ/empty-gno2"}, errShouldContain: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno2/empty.gno: parse: ../../tests/integ/empty-gno2/empty.gno:1:1: expected 'package', found 'EOF'"},
 		// {args: []string{"test", "../../tests/integ/empty-gno3", "--no-precompile"}, recoverShouldBe: "../../tests/integ/empty-gno3/empty_filetest.gno:1:1: expected 'package', found 'EOF'"}, // FIXME: better error handling
-		// {args: []string{"test", "../../tests/integ/empty-gno3"}, errShouldContain: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno3/empty.gno: parse: tmp.gno:1:1: expected 'package', found 'EOF'"},
+		// {args: []string{"test", "../../tests/integ/empty-gno3"}, errShouldContain: "FAIL: 1 build errors, 0 test errors", stderrShouldContain: "../../tests/integ/empty-gno3/empty.gno: parse: ../../tests/integ/empty-gno3/empty.gno:1:1: expected 'package', found 'EOF'"},
 		// {args: []string{"test", "../../tests/integ/failing1", "--verbose", "--no-precompile"}, errShouldBe: "FAIL: 0 build errors, 1 test errors", stderrShouldContain: "FAIL: TestAlwaysFailing"},
 		// {args: []string{"test", "../../tests/integ/failing1", "--verbose"}, errShouldBe: "FAIL: 0 build errors, 1 test errors", stderrShouldContain: "FAIL: TestAlwaysFailing"},
 		// {args: []string{"test", "../../tests/integ/failing2", "--verbose", "--no-precompile"}, recoverShouldBe: "fail on ../../tests/integ/failing2/failing_filetest.gno: got unexpected error: beep boop", stderrShouldContain: "== RUN   file/failing_filetest.gno"},
@@ -137,3 +146,24 @@ func TestTest(t *testing.T) {
 	}
 	testMainCaseRun(t, tc)
 }
+
+func TestTestKeepGenerated(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	mockErr := bytes.NewBufferString("")
+	io := commands.NewTestIO()
+	io.SetErr(commands.WriteNopCloser(mockErr))
+
+	// the files are kept even if the tests fail.
+	cfg := &testCfg{precompile: true, keepGenerated: true}
+	err := execTest(context.Background(), cfg, []string{"../../tests/integ/failing1"}, io)
+	require.EqualError(t, err, "FAIL: 0 build errors, 1 test errors")
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	precompileDir := filepath.Join(tmpDir, entries[0].Name())
+	require.Contains(t, mockErr.String(), "keeping the precompiled files in "+precompileDir+"\n")
+	require.FileExists(t, filepath.Join(precompileDir, "tests", "integ", "failing1", "failing.gno.gen.go"))
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,87 +26,153 @@ func isFileExist(path string) bool {
 	return err == nil
 }
 
-func gnoFilesFromArgs(args []string) ([]string, error) {
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// GnoFilesFromArgs returns the .gno files designated by args, which can be
+// files, directories, or glob patterns of files and directories. The .gno
+// files of the directories are listed, including those of their
+// subdirectories if recursive is set. The files are returned in the order of
+// args, once each even if several args designate them.
+func GnoFilesFromArgs(args []string, recursive bool) ([]string, error) {
+	args, err := expandGlobArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
 	paths := []string{}
+	seen := map[string]bool{}
+	add := func(path string) {
+		if key := filepath.Clean(path); !seen[key] {
+			seen[key] = true
+			paths = append(paths, path)
+		}
+	}
 	for _, arg := range args {
 		info, err := os.Stat(arg)
 		if err != nil {
 			return nil, fmt.Errorf("invalid file or package path: %w", err)
 		}
 		if !info.IsDir() {
-			curpath := arg
-			paths = append(paths, curpath)
-		} else {
-			err = filepath.WalkDir(arg, func(curpath string, f fs.DirEntry, err error) error {
-				if err != nil {
-					return fmt.Errorf("%s: walk dir: %w", arg, err)
-				}
+			add(arg)
+			continue
+		}
 
-				if !isGnoFile(f) {
-					return nil // skip
-				}
-				paths = append(paths, curpath)
-				return nil
-			})
+		err = filepath.WalkDir(arg, func(curpath string, f fs.DirEntry, err error) error {
 			if err != nil {
-				return nil, err
+				return fmt.Errorf("%s: walk dir: %w", arg, err)
+			}
+			if f.IsDir() && curpath != arg && !recursive {
+				return filepath.SkipDir
 			}
+			if !isGnoFile(f) {
+				return nil // skip
+			}
+			add(curpath)
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 	return paths, nil
 }
 
-func gnoPackagesFromArgs(args []string) ([]string, error) {
+// GnoPackagesFromArgs returns the packages designated by args, which can be
+// files, directories, or glob patterns of files and directories. Files are
+// returned as they are, and directories as the directories containing at
+// least one .gno file, among them and, if recursive is set, their
+// subdirectories. The packages are returned in the order of args, once each
+// even if several args designate them.
+func GnoPackagesFromArgs(args []string, recursive bool) ([]string, error) {
+	args, err := expandGlobArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
 	paths := []string{}
+	seen := map[string]bool{} // used to run the builder only once per folder.
 	for _, arg := range args {
 		info, err := os.Stat(arg)
 		if err != nil {
 			return nil, fmt.Errorf("invalid file or package path: %w", err)
 		}
 		if !info.IsDir() {
-			paths = append(paths, arg)
-		} else {
-			// if the passed arg is a dir, then we'll recursively walk the dir
-			// and look for directories containing at least one .gno file.
-
-			visited := map[string]bool{} // used to run the builder only once per folder.
-			err = filepath.WalkDir(arg, func(curpath string, f fs.DirEntry, err error) error {
-				if err != nil {
-					return fmt.Errorf("%s: walk dir: %w", arg, err)
-				}
-				if f.IsDir() {
-					return nil // skip
-				}
-				if !isGnoFile(f) {
-					return nil // skip
-				}
+			if key := filepath.Clean(arg); !seen[key] {
+				seen[key] = true
+				paths = append(paths, arg)
+			}
+			continue
+		}
 
-				parentDir := filepath.Dir(curpath)
-				if _, found := visited[parentDir]; found {
-					return nil
+		// if the passed arg is a dir, then we'll walk the dir and look for
+		// directories containing at least one .gno file.
+		err = filepath.WalkDir(arg, func(curpath string, f fs.DirEntry, err error) error {
+			if err != nil {
+				return fmt.Errorf("%s: walk dir: %w", arg, err)
+			}
+			if f.IsDir() {
+				if curpath != arg && !recursive {
+					return filepath.SkipDir
 				}
-				visited[parentDir] = true
+				return nil // skip
+			}
+			if !isGnoFile(f) {
+				return nil // skip
+			}
 
-				// cannot use path.Join or filepath.Join, because we need
-				// to ensure that ./ is the prefix to pass to go build.
-				pkg := "./" + parentDir
-				paths = append(paths, pkg)
+			parentDir := filepath.Dir(curpath)
+			if seen[filepath.Clean(parentDir)] {
 				return nil
-			})
-			if err != nil {
-				return nil, err
 			}
+			seen[filepath.Clean(parentDir)] = true
+
+			// cannot use path.Join or filepath.Join, because we need
+			// to ensure that ./ is the prefix to pass to go build.
+			pkg := "./" + parentDir
+			paths = append(paths, pkg)
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 	return paths, nil
 }
 
+// expandGlobArgs replaces the glob patterns of args with the paths they
+// match, which must not be empty.
+func expandGlobArgs(args []string) ([]string, error) {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no match for pattern %s", arg)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
 func fmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%.2fs", d.Seconds())
 }
 
 func guessRootDir() string {
-	cmd := exec.Command("go", "list", "-m", "-mod=mod", "-f", "{{.Dir}}", "github.com/gnolang/gno")
+	goBinary, err := gno.LookGoBinary("go")
+	if err != nil {
+		log.Fatalf("can't guess --root-dir, please fill it manually: %s", err)
+	}
+	cmd := exec.Command(goBinary, "list", "-m", "-mod=mod", "-f", "{{.Dir}}", "github.com/gnolang/gno")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Fatal("can't guess --root-dir, please fill it manually.")
@@ -120,25 +187,49 @@ func makeTestGoMod(path string, packageName string, goversion string) error {
 	return os.WriteFile(path, []byte(content), 0o644)
 }
 
-// getPathsFromImportSpec derive and returns ImportPaths
-// without ImportPrefix from *ast.ImportSpec
-func getPathsFromImportSpec(importSpec []*ast.ImportSpec) (importPaths []importPath) {
+// gnoPkgDirs are the directories of the gno packages, relative to the root of
+// the gno repository, as the imports of gno.land/p/ and gno.land/r/ are
+// rewritten by default.
+var gnoPkgDirs = []string{"examples/gno.land/p/", "examples/gno.land/r/"}
+
+// GetPathsFromImportSpec derives and returns the ImportPaths of the gno
+// packages imported by importSpec, once rewritten, in the gno repository at
+// rootDir, which defaults to the current directory. The other imports, of
+// the go stdlib, of the stdshim or outside of the repository, and the
+// packages without a local directory are skipped, as there is nothing to
+// precompile.
+func GetPathsFromImportSpec(rootDir string, importSpec []*ast.ImportSpec) (importPaths []importPath) {
 	for _, i := range importSpec {
-		path := i.Path.Value[1 : len(i.Path.Value)-1] // trim leading and trailing `"`
-		if strings.HasPrefix(path, gno.ImportPrefix) {
-			res := strings.TrimPrefix(path, gno.ImportPrefix)
-			importPaths = append(importPaths, importPath("."+res))
+		path, err := strconv.Unquote(i.Path.Value)
+		if err != nil || !strings.HasPrefix(path, gno.ImportPrefix+"/") {
+			continue
+		}
+		res := strings.TrimPrefix(path, gno.ImportPrefix+"/")
+		for _, dir := range gnoPkgDirs {
+			if !strings.HasPrefix(res, dir) {
+				continue
+			}
+			pkgDir := "./" + res
+			if rootDir != "" {
+				pkgDir = filepath.Join(rootDir, filepath.FromSlash(res))
+			}
+			if isDir(pkgDir) {
+				importPaths = append(importPaths, importPath(pkgDir))
+			}
+			break
 		}
 	}
 	return
 }
 
-// ResolvePath joins the output dir with relative pkg path
+// ResolvePath joins the output dir with the pkg path relative to rootDir, so
+// that the output mirrors the structure of the packages under rootDir.
+// rootDir defaults to the clone location of github.com/gnolang/gno.
 // e.g
 // Output Dir: Temp/gno-precompile
 // Pkg Path: ../example/gno.land/p/pkg
 // Returns -> Temp/gno-precompile/example/gno.land/p/pkg
-func ResolvePath(output string, path importPath) (string, error) {
+func ResolvePath(output string, rootDir string, path importPath) (string, error) {
 	absOutput, err := filepath.Abs(output)
 	if err != nil {
 		return "", err
@@ -147,23 +238,58 @@ func ResolvePath(output string, path importPath) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	pkgPath := strings.TrimPrefix(absPkgPath, guessRootDir())
+	if rootDir == "" {
+		rootDir = guessRootDir()
+	}
+	absRootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	pkgPath, err := filepath.Rel(absRootDir, absPkgPath)
+	if err != nil || pkgPath == ".." || strings.HasPrefix(pkgPath, ".."+string(filepath.Separator)) {
+		// outside of rootDir: mirror the whole absolute path.
+		pkgPath = strings.TrimPrefix(absPkgPath, filepath.VolumeName(absPkgPath))
+	}
 
 	return filepath.Join(absOutput, pkgPath), nil
 }
 
+// renameFile is os.Rename, replaced in tests to simulate write errors.
+var renameFile = os.Rename
+
 // WriteDirFile write file to the path and also create
 // directory if needed. with:
 // Dir perm -> 0755; File perm -> 0o644
+//
+// The data is written to a temporary file of the same directory, renamed
+// into place once complete, so that the file is never seen half-written,
+// e.g. by a concurrent build, nor truncated by a failed write.
 func WriteDirFile(pathWithName string, data []byte) error {
 	path := filepath.Dir(pathWithName)
 
 	// Create Dir if not exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		os.MkdirAll(path, 0o755)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
 	}
 
-	return os.WriteFile(pathWithName, data, 0o644)
+	tmp, err := os.CreateTemp(path, "."+filepath.Base(pathWithName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // once renamed, there is nothing to remove.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return renameFile(tmp.Name(), pathWithName)
 }
 
 // copyDir copies the dir from src to dst, the paths have to be
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGnoFilesAndPackagesFromArgs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/a.gno", "a/b.gno", "a/c.txt", "a/sub/d.gno", "b/e.gno", "b/.hidden.gno"} {
+		err := WriteDirFile(filepath.Join(dir, name), []byte("package foo\n"))
+		require.NoError(t, err)
+	}
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd) //nolint: errcheck
+
+	cases := []struct {
+		name      string
+		args      []string
+		recursive bool
+		files     []string
+		packages  []string
+	}{
+		{
+			name:      "file",
+			args:      []string{"a/a.gno"},
+			recursive: true,
+			files:     []string{"a/a.gno"},
+			packages:  []string{"a/a.gno"},
+		},
+		{
+			name:      "dir",
+			args:      []string{"a"},
+			recursive: true,
+			files:     []string{"a/a.gno", "a/b.gno", "a/sub/d.gno"},
+			packages:  []string{"./a", "./a/sub"},
+		},
+		{
+			name:     "dir not recursive",
+			args:     []string{"a"},
+			files:    []string{"a/a.gno", "a/b.gno"},
+			packages: []string{"./a"},
+		},
+		{
+			name:      "glob",
+			args:      []string{"*/e.gno", "a/*.gno"},
+			recursive: true,
+			files:     []string{"b/e.gno", "a/a.gno", "a/b.gno"},
+			packages:  []string{"b/e.gno", "a/a.gno", "a/b.gno"},
+		},
+		{
+			name:     "glob of dirs",
+			args:     []string{"[ab]"},
+			files:    []string{"a/a.gno", "a/b.gno", "b/e.gno"},
+			packages: []string{"./a", "./b"},
+		},
+		{
+			name:      "overlapping",
+			args:      []string{"a/a.gno", "a", "./a/", "a/sub", "a/*.gno"},
+			recursive: true,
+			files:     []string{"a/a.gno", "a/b.gno", "a/sub/d.gno"},
+			packages:  []string{"a/a.gno", "./a", "./a/sub", "a/b.gno"},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			files, err := GnoFilesFromArgs(c.args, c.recursive)
+			require.NoError(t, err)
+			require.Equal(t, c.files, files)
+
+			packages, err := GnoPackagesFromArgs(c.args, c.recursive)
+			require.NoError(t, err)
+			require.Equal(t, c.packages, packages)
+		})
+	}
+
+	_, err = GnoFilesFromArgs([]string{"c/*.gno"}, true)
+	require.EqualError(t, err, "no match for pattern c/*.gno")
+	_, err = GnoPackagesFromArgs([]string{"["}, true)
+	require.EqualError(t, err, "invalid pattern [: syntax error in pattern")
+	_, err = GnoFilesFromArgs([]string{"c"}, true)
+	require.EqualError(t, err, "invalid file or package path: stat c: no such file or directory")
+}
+
+func TestWriteDirFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "foo.gno.gen.go")
+
+	require.NoError(t, WriteDirFile(path, []byte("package foo\n")))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "package foo\n", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	// a failed write leaves the previous file untouched, and no temp file.
+	defer func(rename func(string, string) error) { renameFile = rename }(renameFile)
+	renameFile = func(string, string) error { return errors.New("disk full") }
+	err = WriteDirFile(path, []byte("package bar\n"))
+	require.EqualError(t, err, "disk full")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "package foo\n", string(data))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestGetPathsFromImportSpec(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, dir := range []string{"examples/gno.land/p/demo/foo", "examples/gno.land/r/demo/bar", "stdlibs/stdshim"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(rootDir, dir), 0o755))
+	}
+
+	source := `package foo
+
+import (
+	"bytes"
+	"github.com/gnolang/gno/stdlibs/stdshim"
+	"github.com/gnolang/gno/examples/gno.land/p/demo/foo"
+	bar "github.com/gnolang/gno/examples/gno.land/r/demo/bar"
+	"github.com/gnolang/gno/examples/gno.land/p/demo/missing"
+	"example.com/examples/gno.land/p/demo/foo"
+)
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "foo.gno", source, parser.ImportsOnly)
+	require.NoError(t, err)
+	require.Equal(t, []importPath{
+		importPath(filepath.Join(rootDir, "examples", "gno.land", "p", "demo", "foo")),
+		importPath(filepath.Join(rootDir, "examples", "gno.land", "r", "demo", "bar")),
+	}, GetPathsFromImportSpec(rootDir, f.Imports))
+
+	// the packages are looked up in rootDir, not in the current directory.
+	require.Empty(t, GetPathsFromImportSpec(t.TempDir(), f.Imports))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gnolang/gno/pkgs/commands"
+	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"github.com/gnolang/gno/pkgs/log"
+)
+
+type watchCfg struct {
+	gobuild      bool
+	goBinary     string
+	rewriteRules string
+	debounce     time.Duration
+}
+
+func newWatchCmd(io *commands.IO) *commands.Command {
+	cfg := &watchCfg{}
+
+	return commands.NewCommand(
+		commands.Metadata{
+			Name:       "watch",
+			ShortUsage: "watch [flags] <package or file> [<package or file>...]",
+			ShortHelp:  "Precompiles .gno files to .go again on each change",
+			LongHelp:   "Precompiles the .gno files of the packages, recursively, or the files, then precompiles them again each time they are written, added or removed, until interrupted",
+		},
+		cfg,
+		func(ctx context.Context, args []string) error {
+			return execWatch(ctx, cfg, args, io)
+		},
+	)
+}
+
+func (c *watchCfg) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(
+		&c.gobuild,
+		"gobuild",
+		false,
+		"run go build on the packages of the changed files",
+	)
+
+	fs.StringVar(
+		&c.goBinary,
+		"go-binary",
+		"go",
+		"go binary to use for building",
+	)
+
+	fs.StringVar(
+		&c.rewriteRules,
+		"rewrite-rules",
+		"",
+		"comma-separated list of before=after import rewrites (a trailing slash rewrites subpackages)",
+	)
+
+	fs.DurationVar(
+		&c.debounce,
+		"debounce",
+		100*time.Millisecond,
+		"quiet period after a change before precompiling, so that bursts of changes are handled once",
+	)
+}
+
+func execWatch(ctx context.Context, cfg *watchCfg, args []string, io *commands.IO) error {
+	if len(args) < 1 {
+		return flag.ErrHelp
+	}
+
+	opts := gno.DefaultPrecompileOptions()
+	if cfg.rewriteRules != "" {
+		rules, err := parseRewriteRules(cfg.rewriteRules)
+		if err != nil {
+			return fmt.Errorf("parse rewrite rules: %w", err)
+		}
+		opts.RewriteRules = rules
+	}
+	if cfg.gobuild {
+		goBinary, err := gno.LookGoBinary(cfg.goBinary)
+		if err != nil {
+			return err
+		}
+		cfg.goBinary = goBinary
+	}
+
+	logger := log.NewTMLogger(log.NewSyncWriter(io.Err))
+	return precompileWatch(ctx, args, opts, cfg, logger)
+}
+
+// precompileWatch precompiles the .gno files of paths, as gnodev precompile
+// does without its imports, then precompiles each file again once it is
+// written or added, and removes the translation of the removed files, until
+// ctx is done. The changes are handled once cfg.debounce elapsed without any
+// other change, and their packages are then built if cfg.gobuild is set.
+func precompileWatch(ctx context.Context, paths []string, opts gno.PrecompileOptions, cfg *watchCfg, logger log.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	defer watcher.Close()
+
+	// fsnotify doesn't watch the subdirectories, so each directory of a
+	// package argument is watched on its own; the files are watched through
+	// their directory, filtered by files.
+	dirs := map[string]bool{}
+	files := map[string]bool{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("invalid file or package path: %w", err)
+		}
+		if !info.IsDir() {
+			files[filepath.Clean(path)] = true
+			if err := watcher.Add(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("watch %s: %w", path, err)
+			}
+			continue
+		}
+		if err := watchDirs(watcher, path, dirs); err != nil {
+			return err
+		}
+	}
+	isWatched := func(path string) bool {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".gno") {
+			return false
+		}
+		return files[path] || dirs[filepath.Dir(path)]
+	}
+
+	initial, err := GnoFilesFromArgs(paths, true)
+	if err != nil {
+		return fmt.Errorf("list paths: %w", err)
+	}
+	watchChanges(ctx, initial, opts, cfg, logger)
+
+	debounce := cfg.debounce
+	if debounce <= 0 {
+		debounce = 100 * time.Millisecond
+	}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	changed := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error("watch", "err", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			path := filepath.Clean(event.Name)
+			// the packages of the new subdirectories are watched too, and
+			// the files written before they were watched are precompiled.
+			if event.Op&fsnotify.Create != 0 && dirs[filepath.Dir(path)] {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					if err := watchDirs(watcher, path, dirs); err != nil {
+						logger.Error("watch", "dir", path, "err", err)
+					}
+					created, err := GnoFilesFromArgs([]string{path}, true)
+					if err != nil {
+						logger.Error("watch", "dir", path, "err", err)
+					}
+					for _, file := range created {
+						if file = filepath.Clean(file); isWatched(file) {
+							changed[file] = true
+						}
+					}
+					if len(changed) > 0 {
+						timer.Reset(debounce)
+					}
+					continue
+				}
+			}
+			if !isWatched(path) {
+				continue
+			}
+			changed[path] = true
+			timer.Reset(debounce)
+		case <-timer.C:
+			paths := make([]string, 0, len(changed))
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			changed = map[string]bool{}
+			sort.Strings(paths)
+			watchChanges(ctx, paths, opts, cfg, logger)
+		}
+	}
+}
+
+// watchDirs watches root and its non-hidden subdirectories, and adds them to
+// dirs.
+func watchDirs(watcher *fsnotify.Watcher, root string, dirs map[string]bool) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("watch %s: %w", path, err)
+		}
+		dirs[filepath.Clean(path)] = true
+		return nil
+	})
+}
+
+// watchChanges precompiles the .gno files at paths, or removes the
+// generated translation of those that no longer exist, and then builds their packages
+// if cfg.gobuild is set. The results are logged, one line per file or
+// package.
+func watchChanges(ctx context.Context, paths []string, opts gno.PrecompileOptions, cfg *watchCfg, logger log.Logger) {
+	naming := opts.OutputNaming
+	if naming == nil {
+		naming = gno.GeneratedOutputNaming
+	}
+
+	var pkgDirs []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			// only a generated translation is removed, not a hand-written
+			// file of the same name.
+			targetPath := filepath.Join(filepath.Dir(path), naming(filepath.Base(path)))
+			removed := false
+			generated, err := gno.IsGeneratedFile(targetPath)
+			if err == nil && generated {
+				err = os.Remove(targetPath)
+				removed = err == nil
+			}
+			if err != nil && !os.IsNotExist(err) {
+				logger.Error("remove", "file", path, "err", err)
+				continue
+			}
+			if removed {
+				logger.Info("removed", "file", path, "target", targetPath)
+			}
+		} else {
+			start := time.Now()
+			targetPath, err := gno.PrecompileFile(path, opts)
+			if err != nil {
+				logger.Error("precompile", "file", path, "err", err)
+				continue
+			}
+			logger.Info("precompiled", "file", path, "target", targetPath, "duration", fmtDuration(time.Since(start)))
+		}
+		if dir := filepath.Dir(path); !seen[dir] {
+			seen[dir] = true
+			pkgDirs = append(pkgDirs, dir)
+		}
+	}
+
+	if !cfg.gobuild {
+		return
+	}
+	goBinary := cfg.goBinary
+	if goBinary == "" {
+		goBinary = "go"
+	}
+	for _, dir := range pkgDirs {
+		start := time.Now()
+		if err := gno.PrecompileBuildPackageContext(ctx, dir, goBinary); err != nil {
+			logger.Error("build", "pkg", dir, "err", err)
+			continue
+		}
+		logger.Info("built", "pkg", dir, "duration", fmtDuration(time.Since(start)))
+	}
+}
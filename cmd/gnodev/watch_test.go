@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gno "github.com/gnolang/gno/pkgs/gnolang"
+	"github.com/gnolang/gno/pkgs/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecompileWatch(t *testing.T) {
+	dir := t.TempDir()
+	fooPath := filepath.Join(dir, "foo.gno")
+	require.NoError(t, os.WriteFile(fooPath, []byte("package foo\n\nfunc Foo() {}\n"), 0o644))
+
+	var out bytes.Buffer
+	logger := log.NewTMLogger(log.NewSyncWriter(&out))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- precompileWatch(ctx, []string{dir}, gno.PrecompileOptions{}, &watchCfg{debounce: 10 * time.Millisecond}, logger)
+	}()
+
+	waitContent := func(path, substr string) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			data, err := os.ReadFile(path)
+			return err == nil && bytes.Contains(data, []byte(substr))
+		}, 5*time.Second, 10*time.Millisecond, "%s should contain %q", path, substr)
+	}
+	waitRemoved := func(path string) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(path)
+			return os.IsNotExist(err)
+		}, 5*time.Second, 10*time.Millisecond, "%s should be removed", path)
+	}
+
+	// the files are precompiled when the watch starts.
+	fooTarget := filepath.Join(dir, "foo.gno.gen.go")
+	waitContent(fooTarget, "func Foo()")
+
+	// written files are precompiled again.
+	require.NoError(t, os.WriteFile(fooPath, []byte("package foo\n\nfunc Foo2() {}\n"), 0o644))
+	waitContent(fooTarget, "func Foo2()")
+
+	// added files, including in new subdirectories, are precompiled.
+	barPath := filepath.Join(dir, "bar.gno")
+	require.NoError(t, os.WriteFile(barPath, []byte("package foo\n\nfunc Bar() {}\n"), 0o644))
+	barTarget := filepath.Join(dir, "bar.gno.gen.go")
+	waitContent(barTarget, "func Bar()")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "baz.gno"), []byte("package sub\n"), 0o644))
+	waitContent(filepath.Join(dir, "sub", "baz.gno.gen.go"), "package sub")
+
+	// the files of directories moved in are precompiled too.
+	moved := filepath.Join(t.TempDir(), "moved")
+	require.NoError(t, os.Mkdir(moved, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(moved, "qux.gno"), []byte("package moved\n"), 0o644))
+	require.NoError(t, os.Rename(moved, filepath.Join(dir, "moved")))
+	waitContent(filepath.Join(dir, "moved", "qux.gno.gen.go"), "package moved")
+
+	// the translations of removed files are removed.
+	require.NoError(t, os.Remove(barPath))
+	waitRemoved(barTarget)
+
+	cancel()
+	require.NoError(t, <-done)
+	require.Contains(t, out.String(), "precompiled")
+	require.Contains(t, out.String(), "removed")
+}
+
+func TestWatchChangesRemoved(t *testing.T) {
+	dir := t.TempDir()
+	handWritten := filepath.Join(dir, "foo.gno.gen.go")
+	require.NoError(t, os.WriteFile(handWritten, []byte("package foo\n"), 0o644))
+
+	// only the removal of a generated translation is logged.
+	var out bytes.Buffer
+	logger := log.NewTMLogger(log.NewSyncWriter(&out))
+	paths := []string{filepath.Join(dir, "foo.gno"), filepath.Join(dir, "bar.gno")}
+	watchChanges(context.Background(), paths, gno.PrecompileOptions{}, &watchCfg{}, logger)
+	require.FileExists(t, handWritten)
+	require.NotContains(t, out.String(), "removed")
+}
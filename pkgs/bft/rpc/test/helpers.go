@@ -14,6 +14,7 @@ import (
 	"github.com/gnolang/gno/pkgs/bft/proxy"
 	ctypes "github.com/gnolang/gno/pkgs/bft/rpc/core/types"
 	rpcclient "github.com/gnolang/gno/pkgs/bft/rpc/lib/client"
+	"github.com/gnolang/gno/pkgs/bft/types"
 	"github.com/gnolang/gno/pkgs/log"
 	"github.com/gnolang/gno/pkgs/p2p"
 )
@@ -23,6 +24,13 @@ import (
 type Options struct {
 	suppressStdout bool
 	recreateConfig bool
+	genesisDoc     *types.GenesisDoc
+	logger         log.Logger
+	rpcTimeout     time.Duration
+	p2pAddress     string
+	rpcAddress     string
+	privValidator  types.PrivValidator
+	clientCreator  proxy.ClientCreator
 }
 
 var (
@@ -30,20 +38,39 @@ var (
 	defaultOptions = Options{
 		suppressStdout: false,
 		recreateConfig: false,
+		rpcTimeout:     10 * time.Second,
 	}
 )
 
-func waitForRPC() {
-	laddr := GetConfig().RPC.ListenAddress
+// maxRPCRetryInterval bounds the interval between the status calls of
+// waitForRPC, which doubles from a millisecond.
+const maxRPCRetryInterval = 100 * time.Millisecond
+
+// waitForRPC waits until the RPC server at laddr answers, for at most
+// timeout, printing the errors meanwhile unless suppressStdout is set.
+func waitForRPC(laddr string, timeout time.Duration, suppressStdout bool) error {
 	client := rpcclient.NewJSONRPCClient(laddr)
 	result := new(ctypes.ResultStatus)
+	deadline := time.Now().Add(timeout)
+	interval := time.Millisecond
 	for {
 		_, err := client.Call("status", map[string]interface{}{}, result)
 		if err == nil {
-			return
-		} else {
+			return nil
+		}
+		if !suppressStdout {
 			fmt.Println("error", err)
-			time.Sleep(time.Millisecond)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("RPC server at %s not ready after %v: %w", laddr, timeout, err)
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		if interval *= 2; interval > maxRPCRetryInterval {
+			interval = maxRPCRetryInterval
 		}
 	}
 }
@@ -80,63 +107,220 @@ func GetConfig(forceCreate ...bool) *cfg.Config {
 	return globalConfig
 }
 
+// ResetGlobalConfig clears the config returned by GetConfig, and removes its
+// root dir, so that the next call of GetConfig creates a fresh one. It is
+// meant to be called between tests mutating the config, e.g. in the
+// teardown of TestMain.
+func ResetGlobalConfig() {
+	if globalConfig != nil {
+		os.RemoveAll(globalConfig.RootDir)
+	}
+	globalConfig = nil
+}
+
 // StartTendermint starts a test tendermint server in a go routine and returns when it is initialized
 func StartTendermint(app abci.Application, opts ...func(*Options)) *nm.Node {
+	node, err := TryStartTendermint(app, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// TryStartTendermint is like StartTendermint, but returns an error instead
+// of panicking, e.g. if the RPC server is not ready after the timeout set by
+// WithRPCTimeout. The node is then stopped and its files cleaned up.
+func TryStartTendermint(app abci.Application, opts ...func(*Options)) (*nm.Node, error) {
 	nodeOpts := defaultOptions
 	for _, opt := range opts {
 		opt(&nodeOpts)
 	}
-	node := NewTendermint(app, &nodeOpts)
-	err := node.Start()
+	node, err := newTendermint(GetConfig(nodeOpts.recreateConfig), app, &nodeOpts)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if err := node.Start(); err != nil {
+		os.RemoveAll(node.Config().RootDir)
+		return nil, err
 	}
 
 	// wait for rpc
-	waitForRPC()
+	if err := waitForRPC(node.Config().RPC.ListenAddress, nodeOpts.rpcTimeout, nodeOpts.suppressStdout); err != nil {
+		stopWithTimeout(node, defaultStopTimeout)
+		return nil, err
+	}
 
 	if !nodeOpts.suppressStdout {
 		fmt.Println("Tendermint running!")
 	}
 
-	return node
+	return node, nil
+}
+
+// defaultStopTimeout is the time StopTendermint waits for the node to stop.
+const defaultStopTimeout = time.Minute
+
+// RPCAddress returns the address the RPC server of the started node
+// listens on, e.g. "tcp://127.0.0.1:26657", with the port it bound if it was
+// random. It is the first address if the node listens on several.
+func RPCAddress(node *nm.Node) string {
+	laddr := node.Config().RPC.ListenAddress
+	if i := strings.Index(laddr, ","); i >= 0 {
+		laddr = laddr[:i]
+	}
+	return strings.TrimSpace(laddr)
+}
+
+// NewClient returns a JSON-RPC client of the started node, at RPCAddress. It
+// panics if the node doesn't answer within the default RPC timeout.
+func NewClient(node *nm.Node) *rpcclient.JSONRPCClient {
+	laddr := RPCAddress(node)
+	if err := waitForRPC(laddr, defaultOptions.rpcTimeout, true); err != nil {
+		panic(err)
+	}
+	return rpcclient.NewJSONRPCClient(laddr)
 }
 
 // StopTendermint stops a test tendermint server, waits until it's stopped and
-// cleans up test/config files.
+// cleans up test/config files. It panics if the node is not stopped after
+// defaultStopTimeout.
 func StopTendermint(node *nm.Node) {
-	node.Stop()
-	node.Wait()
-	os.RemoveAll(node.Config().RootDir)
+	if err := StopTendermintWithTimeout(node, defaultStopTimeout); err != nil {
+		panic(err)
+	}
+}
+
+// StopTendermintWithTimeout stops a test tendermint server and waits until
+// it's stopped, for at most timeout, so that a node deadlocking on shutdown
+// doesn't block the test forever. The test/config files are cleaned up in
+// any case, and an error is returned on timeout.
+func StopTendermintWithTimeout(node *nm.Node, timeout time.Duration) error {
+	return stopWithTimeout(node, timeout)
+}
+
+// stoppable is the part of *nm.Node stopped by stopWithTimeout.
+type stoppable interface {
+	Stop() error
+	Wait()
+	Config() *cfg.Config
+}
+
+func stopWithTimeout(node stoppable, timeout time.Duration) error {
+	defer os.RemoveAll(node.Config().RootDir)
+
+	stopped := make(chan struct{})
+	go func() {
+		node.Stop()
+		node.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("node not stopped after %v", timeout)
+	}
 }
 
 // NewTendermint creates a new tendermint server and sleeps forever
 func NewTendermint(app abci.Application, opts *Options) *nm.Node {
+	node, err := newTendermint(GetConfig(opts.recreateConfig), app, opts)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// NewNodeWithFreshConfig is like NewTendermint, but creates the node with a
+// config of its own, with a unique root dir and random ports, instead of the
+// global one, so that several nodes can run at once, e.g. to test p2p
+// scenarios. Unless WithPrivValidator is set, the node also signs with a
+// validator key generated for it, which its genesis file makes the only
+// validator. The node is started by node.Start.
+//
+// The nodes are not isolated from each other over RPC: the RPC servers all
+// share the global state of rpccore, and answer for the node started last.
+// The other nodes must be inspected through their methods.
+func NewNodeWithFreshConfig(app abci.Application, opts *Options) *nm.Node {
+	config := createConfig()
+	if opts.privValidator == nil {
+		if err := genPrivValidator(config); err != nil {
+			panic(err)
+		}
+	}
+	node, err := newTendermint(config, app, opts)
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// genPrivValidator replaces the validator key of config, which is the same
+// for all the test configs, with a generated one, and makes it the only
+// validator of the genesis file.
+func genPrivValidator(config *cfg.Config) error {
+	pv := privval.GenFilePV(config.PrivValidatorKeyFile(), config.PrivValidatorStateFile())
+	pv.Save()
+
+	genDoc, err := types.GenesisDocFromFile(config.GenesisFile())
+	if err != nil {
+		return err
+	}
+	pubKey := pv.GetPubKey()
+	genDoc.Validators = []types.GenesisValidator{{
+		Address: pubKey.Address(),
+		PubKey:  pubKey,
+		Power:   10,
+	}}
+	return genDoc.SaveAs(config.GenesisFile())
+}
+
+func newTendermint(config *cfg.Config, app abci.Application, opts *Options) (*nm.Node, error) {
 	// Create & start node
-	config := GetConfig(opts.recreateConfig)
+	if opts.p2pAddress != "" {
+		config.P2P.ListenAddress = opts.p2pAddress
+	}
+	if opts.rpcAddress != "" {
+		config.RPC.ListenAddress = opts.rpcAddress
+	}
 	var logger log.Logger
-	if opts.suppressStdout {
+	switch {
+	case opts.logger != nil:
+		logger = opts.logger
+	case opts.suppressStdout:
 		logger = log.NewNopLogger()
-	} else {
+	default:
 		logger = log.NewTMLogger(log.NewSyncWriter(os.Stdout))
 		logger.SetLevel(log.LevelError)
 	}
-	pvKeyFile := config.PrivValidatorKeyFile()
-	pvKeyStateFile := config.PrivValidatorStateFile()
-	pv := privval.LoadOrGenFilePV(pvKeyFile, pvKeyStateFile)
-	papp := proxy.NewLocalClientCreator(app)
+	pv := opts.privValidator
+	if pv == nil {
+		pvKeyFile := config.PrivValidatorKeyFile()
+		pvKeyStateFile := config.PrivValidatorStateFile()
+		pv = privval.LoadOrGenFilePV(pvKeyFile, pvKeyStateFile)
+	}
+	papp := opts.clientCreator
+	if papp == nil {
+		papp = proxy.NewLocalClientCreator(app)
+	}
 	nodeKey, err := p2p.LoadOrGenNodeKey(config.NodeKeyFile())
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	genesisDocProvider := nm.DefaultGenesisDocProviderFunc(config)
+	if opts.genesisDoc != nil {
+		genesisDocProvider = func() (*types.GenesisDoc, error) {
+			return opts.genesisDoc, nil
+		}
 	}
 	node, err := nm.NewNode(config, pv, nodeKey, papp,
-		nm.DefaultGenesisDocProviderFunc(config),
+		genesisDocProvider,
 		nm.DefaultDBProvider,
 		logger)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return node
+	return node, nil
 }
 
 // SuppressStdout is an option that tries to make sure the RPC test Tendermint
@@ -150,3 +334,61 @@ func SuppressStdout(o *Options) {
 func RecreateConfig(o *Options) {
 	o.recreateConfig = true
 }
+
+// WithGenesisDoc is an option that makes the RPC test Tendermint node start
+// from genesisDoc, e.g. to seed validators or app state, instead of the
+// genesis file of the config.
+func WithGenesisDoc(genesisDoc *types.GenesisDoc) func(*Options) {
+	return func(o *Options) {
+		o.genesisDoc = genesisDoc
+	}
+}
+
+// WithLogger is an option that makes the RPC test Tendermint node log to
+// logger, in place of stdout, e.g. to capture the logs of a failing test.
+// The level of logger is left as is, whereas the default logger only logs
+// the errors.
+func WithLogger(logger log.Logger) func(*Options) {
+	return func(o *Options) {
+		o.logger = logger
+	}
+}
+
+// WithRPCTimeout is an option that sets how long StartTendermint waits for
+// the RPC server of the node to be ready, 10 seconds by default.
+func WithRPCTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.rpcTimeout = timeout
+	}
+}
+
+// WithListenAddresses is an option that makes the RPC test Tendermint node
+// listen on the given P2P and RPC addresses, e.g. "tcp://127.0.0.1:26657",
+// instead of random ports, so that the test knows them beforehand. An empty
+// address keeps the random port. The node config holds the addresses the
+// node listens on once it is started, in either case.
+func WithListenAddresses(p2pAddress, rpcAddress string) func(*Options) {
+	return func(o *Options) {
+		o.p2pAddress = p2pAddress
+		o.rpcAddress = rpcAddress
+	}
+}
+
+// WithPrivValidator is an option that makes the RPC test Tendermint node
+// sign with pv, e.g. a types.MockPV of a fixed key, instead of the key file
+// of the config. The genesis validators are left as is.
+func WithPrivValidator(pv types.PrivValidator) func(*Options) {
+	return func(o *Options) {
+		o.privValidator = pv
+	}
+}
+
+// WithClientCreator is an option that makes the RPC test Tendermint node
+// connect to its ABCI application with cc, e.g. to exercise another
+// transport, instead of in process. The app passed to StartTendermint is
+// then ignored.
+func WithClientCreator(cc proxy.ClientCreator) func(*Options) {
+	return func(o *Options) {
+		o.clientCreator = cc
+	}
+}
@@ -0,0 +1,277 @@
+package rpctest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	abcicli "github.com/gnolang/gno/pkgs/bft/abci/client"
+	"github.com/gnolang/gno/pkgs/bft/abci/example/kvstore"
+	cfg "github.com/gnolang/gno/pkgs/bft/config"
+	nm "github.com/gnolang/gno/pkgs/bft/node"
+	"github.com/gnolang/gno/pkgs/bft/proxy"
+	"github.com/gnolang/gno/pkgs/bft/rpc/client"
+	ctypes "github.com/gnolang/gno/pkgs/bft/rpc/core/types"
+	rpcclient "github.com/gnolang/gno/pkgs/bft/rpc/lib/client"
+	"github.com/gnolang/gno/pkgs/bft/types"
+	"github.com/gnolang/gno/pkgs/crypto/ed25519"
+	"github.com/gnolang/gno/pkgs/log"
+)
+
+func TestStartTendermintGenesisDoc(t *testing.T) {
+	config := GetConfig(true)
+	genesisDoc, err := types.GenesisDocFromFile(config.GenesisFile())
+	require.NoError(t, err)
+	genesisDoc.ChainID = "custom-chain"
+	genesisDoc.Validators[0].Power = 42
+
+	node := StartTendermint(kvstore.NewKVStoreApplication(), SuppressStdout, WithGenesisDoc(genesisDoc))
+	defer StopTendermint(node)
+
+	c := rpcclient.NewJSONRPCClient(config.RPC.ListenAddress)
+	result := new(ctypes.ResultGenesis)
+	_, err = c.Call("genesis", map[string]interface{}{}, result)
+	require.NoError(t, err)
+	assert.Equal(t, "custom-chain", result.Genesis.ChainID)
+	if assert.Len(t, result.Genesis.Validators, 1) {
+		assert.Equal(t, int64(42), result.Genesis.Validators[0].Power)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use, as the node logs
+// from its goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStartTendermintLogger(t *testing.T) {
+	var buf syncBuffer
+	logger := log.NewTMLogger(&buf)
+	logger.SetLevel(log.LevelInfo)
+
+	node := StartTendermint(kvstore.NewKVStoreApplication(), SuppressStdout, RecreateConfig, WithLogger(logger))
+	StopTendermint(node)
+
+	assert.Contains(t, buf.String(), "Starting Node")
+}
+
+// captureStdout returns what f prints to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+func TestStartTendermintSuppressStdout(t *testing.T) {
+	out := captureStdout(t, func() {
+		node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig)
+		StopTendermint(node)
+	})
+	assert.Contains(t, out, "Tendermint running!")
+
+	out = captureStdout(t, func() {
+		node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout)
+		StopTendermint(node)
+	})
+	assert.Empty(t, out)
+}
+
+// slowNode is a node taking stopDelay to stop.
+type slowNode struct {
+	config    *cfg.Config
+	stopDelay time.Duration
+}
+
+func (n *slowNode) Stop() error         { return nil }
+func (n *slowNode) Wait()               { time.Sleep(n.stopDelay) }
+func (n *slowNode) Config() *cfg.Config { return n.config }
+
+func TestStopTendermintWithTimeout(t *testing.T) {
+	config := cfg.TestConfig().SetRootDir(t.TempDir())
+
+	err := stopWithTimeout(&slowNode{config: config, stopDelay: time.Hour}, 10*time.Millisecond)
+	assert.EqualError(t, err, "node not stopped after 10ms")
+	assert.NoDirExists(t, config.RootDir)
+
+	config.RootDir = t.TempDir()
+	err = stopWithTimeout(&slowNode{config: config}, time.Minute)
+	assert.NoError(t, err)
+	assert.NoDirExists(t, config.RootDir)
+
+	node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout)
+	assert.NoError(t, StopTendermintWithTimeout(node, time.Minute))
+	assert.NoDirExists(t, node.Config().RootDir)
+}
+
+func TestWaitForRPCTimeout(t *testing.T) {
+	// nothing listens on the port once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	laddr := "tcp://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	start := time.Now()
+	err = waitForRPC(laddr, 200*time.Millisecond, true)
+	assert.ErrorContains(t, err, "RPC server at "+laddr+" not ready after 200ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestStartTendermintListenAddresses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	rpcAddress := "tcp://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout, WithListenAddresses("", rpcAddress))
+	defer StopTendermint(node)
+
+	assert.Equal(t, rpcAddress, node.Config().RPC.ListenAddress)
+	// the P2P port is still random, and resolved once listening.
+	assert.NotContains(t, node.Config().P2P.ListenAddress, ":0")
+
+	c := rpcclient.NewJSONRPCClient(rpcAddress)
+	_, err = c.Call("status", map[string]interface{}{}, new(ctypes.ResultStatus))
+	assert.NoError(t, err)
+}
+
+func TestRPCAddress(t *testing.T) {
+	node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout)
+	defer StopTendermint(node)
+
+	laddr := RPCAddress(node)
+	assert.NotEqual(t, "tcp://127.0.0.1:0", laddr)
+	c := rpcclient.NewJSONRPCClient(laddr)
+	_, err := c.Call("status", map[string]interface{}{}, new(ctypes.ResultStatus))
+	assert.NoError(t, err)
+}
+
+func TestNewClient(t *testing.T) {
+	node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout)
+	defer StopTendermint(node)
+
+	result := new(ctypes.ResultStatus)
+	_, err := NewClient(node).Call("status", map[string]interface{}{}, result)
+	require.NoError(t, err)
+	assert.Equal(t, node.Config().Moniker, result.NodeInfo.Moniker)
+}
+
+func TestNewNodeWithFreshConfig(t *testing.T) {
+	nodeOpts := defaultOptions
+	SuppressStdout(&nodeOpts)
+	node1 := NewNodeWithFreshConfig(kvstore.NewKVStoreApplication(), &nodeOpts)
+	node2 := NewNodeWithFreshConfig(kvstore.NewKVStoreApplication(), &nodeOpts)
+	require.NoError(t, node1.Start())
+	defer StopTendermint(node1)
+	require.NoError(t, node2.Start())
+	defer StopTendermint(node2)
+
+	assert.NotEqual(t, node1.Config().RootDir, node2.Config().RootDir)
+	assert.NotEqual(t, node1.NodeInfo().ID(), node2.NodeInfo().ID())
+	assert.NotEqual(t, RPCAddress(node1), RPCAddress(node2))
+	assert.NotSame(t, GetConfig(), node1.Config())
+
+	// each node is the only validator of its chain, with a key of its own.
+	addr1 := node1.PrivValidator().GetPubKey().Address()
+	addr2 := node2.PrivValidator().GetPubKey().Address()
+	assert.NotEqual(t, addr1, addr2)
+	assert.Equal(t, addr1, node1.GenesisDoc().Validators[0].Address)
+	assert.Equal(t, addr2, node2.GenesisDoc().Validators[0].Address)
+
+	// the RPC servers both answer for the node started last.
+	for _, node := range []*nm.Node{node1, node2} {
+		result := new(ctypes.ResultStatus)
+		_, err := NewClient(node).Call("status", map[string]interface{}{}, result)
+		require.NoError(t, err)
+		assert.Equal(t, node2.NodeInfo().ID(), result.NodeInfo.ID())
+		assert.Equal(t, node2.GenesisDoc().ChainID, result.NodeInfo.Network)
+		assert.Equal(t, addr2, result.ValidatorInfo.Address)
+	}
+}
+
+func TestStartTendermintPrivValidator(t *testing.T) {
+	pv := types.NewMockPVWithParams(ed25519.GenPrivKeyFromSecret([]byte("rpctest")), false, false)
+
+	node := StartTendermint(kvstore.NewKVStoreApplication(), RecreateConfig, SuppressStdout, WithPrivValidator(pv))
+	defer StopTendermint(node)
+
+	result := new(ctypes.ResultStatus)
+	_, err := NewClient(node).Call("status", map[string]interface{}{}, result)
+	require.NoError(t, err)
+	assert.Equal(t, pv.GetPubKey().Address(), result.ValidatorInfo.Address)
+}
+
+func TestResetGlobalConfig(t *testing.T) {
+	// the root dir of the config is removed by the tests stopping its node.
+	ResetGlobalConfig()
+	config := GetConfig()
+	config.Moniker = "mutated"
+	require.DirExists(t, config.RootDir)
+
+	ResetGlobalConfig()
+	assert.NoDirExists(t, config.RootDir)
+
+	fresh := GetConfig()
+	assert.NotSame(t, config, fresh)
+	assert.NotEqual(t, config.RootDir, fresh.RootDir)
+	assert.NotEqual(t, "mutated", fresh.Moniker)
+	assert.Same(t, fresh, GetConfig())
+
+	ResetGlobalConfig()
+}
+
+// countingClientCreator counts the ABCI clients it creates.
+type countingClientCreator struct {
+	proxy.ClientCreator
+	clients int
+}
+
+func (cc *countingClientCreator) NewABCIClient() (abcicli.Client, error) {
+	cc.clients++
+	return cc.ClientCreator.NewABCIClient()
+}
+
+func TestStartTendermintClientCreator(t *testing.T) {
+	cc := &countingClientCreator{ClientCreator: proxy.NewLocalClientCreator(kvstore.NewKVStoreApplication())}
+
+	node := StartTendermint(nil, RecreateConfig, SuppressStdout, WithClientCreator(cc))
+	defer StopTendermint(node)
+	assert.NotZero(t, cc.clients)
+
+	res, err := client.NewHTTP(RPCAddress(node), "/websocket").ABCIQuery("", []byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), res.Response.Key)
+	assert.Equal(t, "does not exist", res.Response.Log)
+}
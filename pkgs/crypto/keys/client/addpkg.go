@@ -17,9 +17,10 @@ import (
 type addPkgCfg struct {
 	rootCfg *makeTxCfg
 
-	pkgPath string
-	pkgDir  string
-	deposit string
+	pkgPath    string
+	pkgDir     string
+	deposit    string
+	syntaxOnly bool
 }
 
 func newAddPkgCmd(rootCfg *makeTxCfg) *commands.Command {
@@ -31,6 +32,7 @@ func newAddPkgCmd(rootCfg *makeTxCfg) *commands.Command {
 		commands.Metadata{
 			Name:       "addpkg",
 			ShortUsage: "addpkg [flags] <key-name>",
+			LongHelp:   "Uploads a new package; with -syntax-only, only checks the package, without any key",
 			ShortHelp:  "Uploads a new package",
 		},
 		cfg,
@@ -61,9 +63,19 @@ func (c *addPkgCfg) RegisterFlags(fs *flag.FlagSet) {
 		"",
 		"deposit coins",
 	)
+
+	fs.BoolVar(
+		&c.syntaxOnly,
+		"syntax-only",
+		false,
+		"only precompile and check the syntax of the package, without making a transaction",
+	)
 }
 
 func execAddPkg(cfg *addPkgCfg, args []string, io *commands.IO) error {
+	if err := cfg.rootCfg.validate(); err != nil {
+		return err
+	}
 	if cfg.pkgPath == "" {
 		return errors.New("pkgpath not specified")
 	}
@@ -71,6 +83,22 @@ func execAddPkg(cfg *addPkgCfg, args []string, io *commands.IO) error {
 		return errors.New("pkgdir not specified")
 	}
 
+	// open files in directory as MemPackage; the package is named after
+	// its .gno files.
+	memPkg, err := readMemPackage(cfg.pkgDir, cfg.pkgPath)
+	if err != nil {
+		return fmt.Errorf("read package: %w", err)
+	}
+
+	// validate the package, precompile it and check its syntax
+	err = gno.PrecompileAndCheckMempkg(memPkg)
+	if err != nil {
+		return fmt.Errorf("precompile: %w", err)
+	}
+	if cfg.syntaxOnly {
+		return nil
+	}
+
 	if len(args) != 1 {
 		return flag.ErrHelp
 	}
@@ -91,23 +119,14 @@ func execAddPkg(cfg *addPkgCfg, args []string, io *commands.IO) error {
 	// parse deposit.
 	deposit, err := std.ParseCoins(cfg.deposit)
 	if err != nil {
-		panic(err)
-	}
-
-	// open files in directory as MemPackage.
-	memPkg := gno.ReadMemPackage(cfg.pkgDir, cfg.pkgPath)
-
-	// precompile and validate syntax
-	err = gno.PrecompileAndCheckMempkg(memPkg)
-	if err != nil {
-		panic(err)
+		return fmt.Errorf("parse deposit: %w", err)
 	}
 
 	// parse gas wanted & fee.
 	gaswanted := cfg.rootCfg.gasWanted
 	gasfee, err := std.ParseCoin(cfg.rootCfg.gasFee)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("parse gas fee: %w", err)
 	}
 	// construct msg & tx and marshal.
 	msg := vm.MsgAddPackage{
@@ -122,7 +141,7 @@ func execAddPkg(cfg *addPkgCfg, args []string, io *commands.IO) error {
 		Memo:       cfg.rootCfg.memo,
 	}
 
-	if cfg.rootCfg.broadcast {
+	if cfg.rootCfg.broadcast || cfg.rootCfg.simulate {
 		err := signAndBroadcast(cfg.rootCfg, args, tx, io)
 		if err != nil {
 			return err
@@ -133,6 +152,17 @@ func execAddPkg(cfg *addPkgCfg, args []string, io *commands.IO) error {
 	return nil
 }
 
+// readMemPackage is like gno.ReadMemPackage, but returns an error instead of
+// panicking when a file can't be read or parsed.
+func readMemPackage(dir string, pkgPath string) (memPkg *std.MemPackage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("%v", r)
+		}
+	}()
+	return gno.ReadMemPackage(dir, pkgPath), nil
+}
+
 func signAndBroadcast(
 	cfg *makeTxCfg,
 	args []string,
@@ -193,15 +223,25 @@ func signAndBroadcast(
 		return errors.Wrap(err, "sign tx")
 	}
 
-	// broadcast signed tx
+	// broadcast signed tx, or only simulate it.
 	bopts := &broadcastCfg{
 		rootCfg: baseopts,
 		tx:      signedTx,
+		dryRun:  txopts.simulate,
 	}
 	bres, err := broadcastHandler(bopts)
 	if err != nil {
 		return errors.Wrap(err, "broadcast tx")
 	}
+	if txopts.simulate {
+		io.Println(string(amino.MustMarshalJSON(signedTx)))
+		io.Println("GAS WANTED:", signedTx.Fee.GasWanted)
+		io.Println("GAS USED:  ", bres.DeliverTx.GasUsed)
+		if bres.DeliverTx.IsErr() {
+			return errors.Wrap(bres.DeliverTx.Error, "simulate transaction failed: log:%s", bres.DeliverTx.Log)
+		}
+		return nil
+	}
 	if bres.CheckTx.IsErr() {
 		return errors.Wrap(bres.CheckTx.Error, "check transaction failed: log:%s", bres.CheckTx.Log)
 	}
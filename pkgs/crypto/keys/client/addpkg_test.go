@@ -0,0 +1,117 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/commands"
+	"github.com/gnolang/gno/pkgs/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_execAddPkgSyntaxOnly(t *testing.T) {
+	t.Parallel()
+
+	pkgDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(pkgDir, "foo.gno"), []byte("package foo\n\nfunc Foo() int { return 1 }\n"), 0o644)
+	assert.NoError(t, err)
+
+	cfg := &addPkgCfg{
+		rootCfg:    &makeTxCfg{},
+		pkgPath:    "gno.land/p/demo/foo",
+		pkgDir:     pkgDir,
+		syntaxOnly: true,
+	}
+
+	// no key is needed to check the package.
+	err = execAddPkg(cfg, nil, commands.NewTestIO())
+	assert.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(pkgDir, "foo.gno"), []byte("package foo\n\nimport \"reflect\"\n"), 0o644)
+	assert.NoError(t, err)
+	err = execAddPkg(cfg, nil, commands.NewTestIO())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "precompile: ")
+		assert.Contains(t, err.Error(), `import "reflect" is not in the whitelist`)
+	}
+
+	// syntax errors are returned, not panicked.
+	err = os.WriteFile(filepath.Join(pkgDir, "foo.gno"), []byte("package foo\n\nfunc Foo() int {\n"), 0o644)
+	assert.NoError(t, err)
+	assert.NotPanics(t, func() {
+		err = execAddPkg(cfg, nil, commands.NewTestIO())
+	})
+	assert.EqualError(t, err, "read package: foo.gno:3:18: expected '}', found 'EOF'")
+}
+
+func Test_execAddPkgGoFiles(t *testing.T) {
+	t.Parallel()
+
+	// the go files of the directory are read, but ignored by the precompiler.
+	pkgDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(pkgDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(pkgDir, "foo.go"), []byte("package foo\n"), 0o644)
+	assert.NoError(t, err)
+
+	cfg := &addPkgCfg{
+		rootCfg:    &makeTxCfg{},
+		pkgPath:    "gno.land/p/demo/foo",
+		pkgDir:     pkgDir,
+		syntaxOnly: true,
+	}
+	err = execAddPkg(cfg, nil, commands.NewTestIO())
+	assert.NoError(t, err)
+}
+
+func Test_execAddPkgErrors(t *testing.T) {
+	t.Parallel()
+
+	kbHome, kbCleanUp := testutils.NewTestCaseDir(t)
+	defer kbCleanUp()
+	io := commands.NewTestIO()
+	io.SetIn(strings.NewReader("test1234\ntest1234\n"))
+	addCfg := &addCfg{
+		rootCfg: &baseCfg{
+			BaseOptions: BaseOptions{
+				InsecurePasswordStdin: true,
+				Home:                  kbHome,
+			},
+		},
+	}
+	err := execAdd(addCfg, []string{"keyname1"}, io)
+	assert.NoError(t, err)
+
+	pkgDir := t.TempDir()
+	cfg := &addPkgCfg{
+		rootCfg: &makeTxCfg{
+			rootCfg: addCfg.rootCfg,
+			gasFee:  "1ugnot",
+		},
+		pkgPath: "gno.land/p/demo/foo",
+		pkgDir:  pkgDir,
+		deposit: "invalid",
+	}
+	err = execAddPkg(cfg, []string{"keyname1"}, commands.NewTestIO())
+	assert.EqualError(t, err, `read package: cannot create package with invalid name ""`)
+
+	err = os.WriteFile(filepath.Join(pkgDir, "foo.gno"), []byte("package foo\n"), 0o644)
+	assert.NoError(t, err)
+	assert.NotPanics(t, func() {
+		err = execAddPkg(cfg, []string{"keyname1"}, commands.NewTestIO())
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "parse deposit: ")
+	}
+
+	cfg.deposit = ""
+	cfg.rootCfg.gasFee = "invalid"
+	assert.NotPanics(t, func() {
+		err = execAddPkg(cfg, []string{"keyname1"}, commands.NewTestIO())
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "parse gas fee: ")
+	}
+}
@@ -70,6 +70,9 @@ func (c *callCfg) RegisterFlags(fs *flag.FlagSet) {
 }
 
 func execCall(cfg *callCfg, args []string, io *commands.IO) error {
+	if err := cfg.rootCfg.validate(); err != nil {
+		return err
+	}
 	if cfg.pkgPath == "" {
 		return errors.New("pkgpath not specified")
 	}
@@ -130,7 +133,7 @@ func execCall(cfg *callCfg, args []string, io *commands.IO) error {
 		Memo:       cfg.rootCfg.memo,
 	}
 
-	if cfg.rootCfg.broadcast {
+	if cfg.rootCfg.broadcast || cfg.rootCfg.simulate {
 		err := signAndBroadcast(cfg.rootCfg, args, tx, io)
 		if err != nil {
 			return err
@@ -4,6 +4,7 @@ import (
 	"flag"
 
 	"github.com/gnolang/gno/pkgs/commands"
+	"github.com/gnolang/gno/pkgs/errors"
 )
 
 type makeTxCfg struct {
@@ -14,6 +15,7 @@ type makeTxCfg struct {
 	memo      string
 
 	broadcast bool
+	simulate  bool
 	chainID   string
 }
 
@@ -70,10 +72,25 @@ func (c *makeTxCfg) RegisterFlags(fs *flag.FlagSet) {
 		"sign and broadcast",
 	)
 
+	fs.BoolVar(
+		&c.simulate,
+		"simulate",
+		false,
+		"sign and simulate the tx without broadcasting it, to report the gas it uses",
+	)
+
 	fs.StringVar(
 		&c.chainID,
 		"chainid",
 		"dev",
-		"chainid to sign for (only useful if --broadcast)",
+		"chainid to sign for (only useful if --broadcast or --simulate)",
 	)
 }
+
+// validate checks the flags common to the maketx subcommands.
+func (c *makeTxCfg) validate() error {
+	if c.broadcast && c.simulate {
+		return errors.New("broadcast and simulate are mutually exclusive")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/amino"
+	abci "github.com/gnolang/gno/pkgs/bft/abci/types"
+	rpctest "github.com/gnolang/gno/pkgs/bft/rpc/test"
+	"github.com/gnolang/gno/pkgs/commands"
+	"github.com/gnolang/gno/pkgs/crypto"
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/gnolang/gno/pkgs/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// simulateApp answers the account queries, simulates the txs with a fixed
+// gas usage, and counts the txs broadcast to it.
+type simulateApp struct {
+	abci.BaseApplication
+
+	mu        sync.Mutex
+	broadcast int
+}
+
+func (app *simulateApp) Query(req abci.RequestQuery) (res abci.ResponseQuery) {
+	switch {
+	case strings.HasPrefix(req.Path, "auth/accounts/"):
+		var account struct{ BaseAccount std.BaseAccount }
+		account.BaseAccount.AccountNumber = 1
+		res.Data = amino.MustMarshalJSON(account)
+	case req.Path == ".app/simulate":
+		res.Value = amino.MustMarshal(abci.ResponseDeliverTx{GasUsed: 1234})
+	}
+	return
+}
+
+func (app *simulateApp) CheckTx(req abci.RequestCheckTx) abci.ResponseCheckTx {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.broadcast++
+	return abci.ResponseCheckTx{}
+}
+
+func Test_execSendSimulate(t *testing.T) {
+	kbHome, kbCleanUp := testutils.NewTestCaseDir(t)
+	defer kbCleanUp()
+	io := commands.NewTestIO()
+	io.SetIn(strings.NewReader("test1234\ntest1234\n"))
+	addCfg := &addCfg{
+		rootCfg: &baseCfg{
+			BaseOptions: BaseOptions{
+				InsecurePasswordStdin: true,
+				Home:                  kbHome,
+			},
+		},
+	}
+	require.NoError(t, execAdd(addCfg, []string{"keyname1"}, io))
+
+	app := &simulateApp{}
+	node := rpctest.StartTendermint(app, rpctest.RecreateConfig, rpctest.SuppressStdout)
+	defer rpctest.StopTendermint(node)
+	addCfg.rootCfg.Remote = rpctest.RPCAddress(node)
+
+	cfg := &sendCfg{
+		rootCfg: &makeTxCfg{
+			rootCfg:   addCfg.rootCfg,
+			gasWanted: 2000,
+			gasFee:    "1ugnot",
+			simulate:  true,
+			chainID:   "dev",
+		},
+		send: "10ugnot",
+		to:   crypto.AddressFromPreimage([]byte("to")).String(),
+	}
+	var out bytes.Buffer
+	io = commands.NewTestIO()
+	io.SetIn(strings.NewReader("test1234\n"))
+	io.SetOut(commands.WriteNopCloser(&out))
+	require.NoError(t, execSend(cfg, []string{"keyname1"}, io))
+
+	// the signed tx is printed along with the gas estimate, but not
+	// broadcast.
+	assert.Contains(t, out.String(), `"signature":`)
+	assert.Contains(t, out.String(), "GAS WANTED: 2000\n")
+	assert.Contains(t, out.String(), "GAS USED:   1234\n")
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	assert.Zero(t, app.broadcast)
+}
+
+func TestMakeTxBroadcastAndSimulate(t *testing.T) {
+	rootCfg := &makeTxCfg{
+		rootCfg:   &baseCfg{},
+		gasWanted: 2000,
+		gasFee:    "1ugnot",
+		broadcast: true,
+		simulate:  true,
+	}
+	io := commands.NewTestIO()
+
+	err := execSend(&sendCfg{rootCfg: rootCfg, send: "10ugnot"}, []string{"keyname1"}, io)
+	assert.EqualError(t, err, "broadcast and simulate are mutually exclusive")
+	err = execCall(&callCfg{rootCfg: rootCfg, pkgPath: "gno.land/r/demo/foo", funcName: "Foo"}, []string{"keyname1"}, io)
+	assert.EqualError(t, err, "broadcast and simulate are mutually exclusive")
+	err = execAddPkg(&addPkgCfg{rootCfg: rootCfg, pkgPath: "gno.land/r/demo/foo", pkgDir: "."}, []string{"keyname1"}, io)
+	assert.EqualError(t, err, "broadcast and simulate are mutually exclusive")
+}
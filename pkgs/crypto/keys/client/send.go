@@ -56,6 +56,9 @@ func (c *sendCfg) RegisterFlags(fs *flag.FlagSet) {
 }
 
 func execSend(cfg *sendCfg, args []string, io *commands.IO) error {
+	if err := cfg.rootCfg.validate(); err != nil {
+		return err
+	}
 	if len(args) != 1 {
 		return flag.ErrHelp
 	}
@@ -118,7 +121,7 @@ func execSend(cfg *sendCfg, args []string, io *commands.IO) error {
 		Memo:       cfg.rootCfg.memo,
 	}
 
-	if cfg.rootCfg.broadcast {
+	if cfg.rootCfg.broadcast || cfg.rootCfg.simulate {
 		err := signAndBroadcast(cfg.rootCfg, args, tx, io)
 		if err != nil {
 			return err
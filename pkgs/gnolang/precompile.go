@@ -1,22 +1,36 @@
 package gnolang
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/build/constraint"
 	"go/format"
 	"go/parser"
 	"go/token"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/gnolang/gno/pkgs/std"
 	"go.uber.org/multierr"
 	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/imports"
 )
 
 const (
@@ -26,6 +40,8 @@ const (
 	gnoPackagePrefixAfter    = "github.com/gnolang/gno/examples/gno.land/p/demo/"
 	gnoStdPkgBefore          = "std"
 	gnoStdPkgAfter           = "github.com/gnolang/gno/stdlibs/stdshim"
+	gnoTestingPkgBefore      = "testing"
+	gnoTestingPkgAfter       = "github.com/gnolang/gno/stdlibs/testing"
 )
 
 var stdlibWhitelist = []string{
@@ -44,7 +60,7 @@ var stdlibWhitelist = []string{
 	"flag",
 	"fmt",
 	"io",
-	"io/util",
+	"io/ioutil",
 	"math",
 	"math/big",
 	"math/rand",
@@ -58,6 +74,7 @@ var stdlibWhitelist = []string{
 
 	// gno
 	"std",
+	"testing",
 }
 
 var importPrefixWhitelist = []string{
@@ -66,30 +83,826 @@ var importPrefixWhitelist = []string{
 
 const ImportPrefix = "github.com/gnolang/gno"
 
+// GeneratedHeader is the first line of the files generated by Precompile.
+const GeneratedHeader = "// Code generated by github.com/gnolang/gno. DO NOT EDIT."
+
+// NoHeaderTags is the tags value for which Precompile writes no header at
+// all, neither the generated-code line nor the build constraints.
+const NoHeaderTags = "no_header"
+
+// generatedHeaderPrefix starts the first line of the generated files, also
+// when rendered from a PrecompileOptions.HeaderTemplate, so that the files
+// of other generators are not mistaken for them.
+const generatedHeaderPrefix = "// Code generated by github.com/gnolang/gno"
+
+var generatedHeaderRegexp = regexp.MustCompile(`^` + regexp.QuoteMeta(generatedHeaderPrefix) + `\b.*$`)
+
+// RewriteRule rewrites the imports of the Before package to the After
+// package. If Before ends with a slash, all the packages under Before are
+// rewritten to the same packages under After.
+type RewriteRule struct {
+	Before string
+	After  string
+}
+
+func (r RewriteRule) isPrefix() bool {
+	return strings.HasSuffix(r.Before, "/")
+}
+
+func (r RewriteRule) match(importPath string) bool {
+	if r.isPrefix() {
+		return strings.HasPrefix(importPath, r.Before)
+	}
+	return importPath == r.Before
+}
+
+func (r RewriteRule) rewrite(importPath string) string {
+	return r.After + strings.TrimPrefix(importPath, r.Before)
+}
+
+// StdShimRenames maps the symbols of the gno std package to their name in the
+// stdshim package, when they differ. The selectors of these symbols are
+// renamed when the std import is rewritten to stdshim.
+//
+// It is empty for now, but downstream users can extend it.
+var StdShimRenames = map[string]string{}
+
+// stdShimSymbols are the exported symbols of the stdshim package.
+var stdShimSymbols = []string{
+	"Address",
+	"AddressList",
+	"AddressSet",
+	"AssertOriginCall",
+	"Banker",
+	"BankerType",
+	"BankerTypeOrigSend",
+	"BankerTypeReadonly",
+	"BankerTypeRealmIssue",
+	"BankerTypeRealmSend",
+	"Coin",
+	"Coins",
+	"CurrentRealmPath",
+	"DecodeBech32",
+	"DerivePkgAddr",
+	"EncodeBech32",
+	"FormatTimestamp",
+	"GetBanker",
+	"GetCallerAt",
+	"GetChainID",
+	"GetHeight",
+	"GetOrigCaller",
+	"GetOrigPkgAddr",
+	"GetOrigSend",
+	"GetTimestamp",
+	"Hash",
+	"IsOriginCall",
+	"NewAddressList",
+	"RawAddress",
+	"RawAddressSize",
+	"Time",
+}
+
+// RewriteRules is the set of rules used to rewrite gno imports to go imports.
+type RewriteRules []RewriteRule
+
+// DefaultRewriteRules rewrites gno imports to the packages of the
+// github.com/gnolang/gno module.
+var DefaultRewriteRules = RewriteRules{
+	{Before: gnoStdPkgBefore, After: gnoStdPkgAfter},
+	{Before: gnoTestingPkgBefore, After: gnoTestingPkgAfter},
+	{Before: gnoPackagePrefixBefore, After: gnoPackagePrefixAfter},
+	{Before: gnoRealmPkgsPrefixBefore, After: gnoRealmPkgsPrefixAfter},
+}
+
+// Validate checks that every rule has a Before path, and that no import
+// can be matched by more than one rule.
+func (rules RewriteRules) Validate() error {
+	for i, rule := range rules {
+		if rule.Before == "" {
+			return fmt.Errorf("rewrite rule #%d: empty before path", i)
+		}
+		if rule.After == "" {
+			return fmt.Errorf("rewrite rule %q: empty after path", rule.Before)
+		}
+		if rule.isPrefix() != strings.HasSuffix(rule.After, "/") {
+			return fmt.Errorf("rewrite rule %q: before and after paths must both end with a slash, or neither", rule.Before)
+		}
+		for _, other := range rules[:i] {
+			if other.match(rule.Before) || rule.match(other.Before) {
+				return fmt.Errorf("rewrite rules %q and %q overlap", other.Before, rule.Before)
+			}
+		}
+	}
+	return nil
+}
+
+// Rewrite returns the import path importPath is rewritten to, or importPath
+// itself if no rule matches it.
+func (rules RewriteRules) Rewrite(importPath string) string {
+	if rule, ok := rules.find(importPath); ok {
+		return rule.rewrite(importPath)
+	}
+	return importPath
+}
+
+// without returns the rules but the one rewriting the before path.
+func (rules RewriteRules) without(before string) RewriteRules {
+	var filtered RewriteRules
+	for _, rule := range rules {
+		if rule.Before != before {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+func (rules RewriteRules) find(importPath string) (RewriteRule, bool) {
+	for _, rule := range rules {
+		if rule.match(importPath) {
+			return rule, true
+		}
+	}
+	return RewriteRule{}, false
+}
+
+// PrecompileOptions configures the translation done by PrecompileWithOptions.
+type PrecompileOptions struct {
+	// RewriteRules are the rules used to rewrite imports.
+	// DefaultRewriteRules are used if empty.
+	RewriteRules RewriteRules
+	// Gobuild makes PrecompileMemPkg build the translated package,
+	// written to a temporary directory, with GoBinary ("go" if empty),
+	// as resolved by LookGoBinary.
+	Gobuild  bool
+	GoBinary string
+	// Test makes PrecompileMemPkg run the tests of the translated package
+	// with go test, instead of only building it. The testing import is then
+	// not rewritten to the gno testing package.
+	Test bool
+	// Run makes PrecompileMemPkg run the translated package, which must be
+	// a main package, with go run, instead of only building it. The
+	// program gets Args as arguments and Stdin as standard input, and its
+	// combined output is reported.
+	Run   bool
+	Args  []string
+	Stdin io.Reader
+	// BuildEnv, if not nil, replaces the environment of the go toolchain
+	// run by PrecompileMemPkg and PrecompileBuildPackageWithOptions, so
+	// that the builds don't depend on the variables of the caller, e.g.
+	// GOFLAGS. The variables the toolchain needs to work, listed in
+	// buildEnvEssentials, are still inherited, unless BuildEnv sets them.
+	BuildEnv []string
+	// Offline makes the go toolchain run by PrecompileMemPkg and
+	// PrecompileBuildPackageWithOptions use the module cache only, with
+	// GOPROXY=off and GOFLAGS=-mod=readonly, so that the builds never hang
+	// on a download, e.g. in a sealed CI. A missing module then fails the
+	// build with an error wrapping ErrOffline.
+	Offline bool
+	// WorkDir, if set, is the directory to which PrecompileMemPkg writes
+	// the translated package to build it, in place of a temporary one, and
+	// which is kept afterwards, e.g. to inspect a failed build. It is
+	// created if needed, and must be empty.
+	WorkDir string
+	// RunTimeout is the maximum duration of the build, if positive.
+	RunTimeout time.Duration
+	// RootDir is the clone location of github.com/gnolang/gno, from which
+	// the gno imports are resolved when building in a temporary directory,
+	// or the module root from which PrecompileBuildPackageWithOptions runs
+	// go build. It is guessed from the working or package directory if
+	// empty, with go list, or else as the nearest module above it.
+	RootDir string
+	// HeaderTemplate is a text/template rendering the header of the
+	// generated files, in place of GeneratedHeader. It can refer to
+	// {{.SourcePath}}, the .gno file, and {{.Timestamp}}, the RFC 3339 UTC
+	// time of the translation. Its first line must start with
+	// "// Code generated by github.com/gnolang/gno", so that the files are
+	// still recognized by IsGeneratedFile; the "DO NOT EDIT." suffix is
+	// optional.
+	HeaderTemplate string
+	// RealmMode annotates the package-level variables, which are the
+	// persistent state of realms, and reports them in the result. Their
+	// translation remains a plain go global, which is neither persisted nor
+	// rolled back: the mode is only meant to run realms locally.
+	RealmMode bool
+	// GoVersion, if set, is the go language version of the generated files,
+	// of the form "go1.N". It is required by their build constraints, so
+	// that older toolchains fail to build them, and PrecompileMemPkg
+	// compiles them with -lang set to it.
+	GoVersion string
+	// OutputNaming names the .go files written by PrecompileFile and
+	// PrecompileMemPkg, and compared by PrecompileDiff. It is
+	// GeneratedOutputNaming if nil.
+	OutputNaming OutputNaming
+	// OnFile, if set, is called by PrecompileFile with each translation
+	// before it is written to targetPath, e.g. to lint it or to collect
+	// metrics. The returned bytes are written instead, so that the hook can
+	// transform them, and an error aborts the precompilation of the file.
+	OnFile func(srcPath, targetPath string, translated []byte) ([]byte, error)
+	// OutputFS receives the files written by PrecompileFile, in place of
+	// the OS filesystem, e.g. to precompile where it is not writable. The
+	// .gno sources are still read from the OS filesystem.
+	OutputFS OutputFS
+	// WhitelistMode is how the import whitelist is applied to the files
+	// that are not tests. Relaxing it is meant to experiment with a stdlib
+	// package before it is whitelisted, and must not be done for untrusted
+	// sources. It doesn't apply if SkipWhitelist is set.
+	WhitelistMode WhitelistMode
+	// SkipWhitelist disables the import whitelist check for all the files,
+	// whatever WhitelistMode, e.g. to experiment with a stdlib package
+	// before it is whitelisted. Each file that would have been checked gets
+	// a warning diagnostic saying so. It must not be used for untrusted
+	// sources.
+	SkipWhitelist bool
+	// PruneUnusedImports removes the imports that are not referred to in
+	// the translation, as gno accepts them, or the transformations may make
+	// them unused, but go build would fail. Only the imports whose package
+	// name is known are removed: see importName. It is set by
+	// DefaultPrecompileOptions, which the callers should start from.
+	PruneUnusedImports bool
+	// FixImports runs goimports on the translation, in place of the removal
+	// of the unused imports: it also adds the imports of the packages
+	// referred to without being imported, e.g. by a transformation. It may
+	// look the packages up in the module of the source, and is slower.
+	FixImports bool
+	// RewriteBuiltinPrint rewrites the calls of the println and print
+	// builtins, which write to the standard error in go, to fmt.Println and
+	// fmt.Print, importing fmt if needed, so that the output of a program
+	// run by PrecompileMemPkg can be told from its errors. The formatting
+	// of fmt.Print differs slightly, as it separates its operands that are
+	// not strings by spaces.
+	RewriteBuiltinPrint bool
+	// Stdout and Stderr, if set, receive the output of the go toolchain
+	// while it runs. The output is still buffered to build the returned
+	// errors, but the streamed copy refers to the temporary files.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Transforms are applied to the AST of each file, in order, after the
+	// built-in transformations. They are registered with AddTransform.
+	Transforms []Transformer
+}
+
+// DefaultPrecompileOptions returns the options used by Precompile, which
+// prune the unused imports.
+func DefaultPrecompileOptions() PrecompileOptions {
+	return PrecompileOptions{PruneUnusedImports: true}
+}
+
+// Transformer is a custom transformation of the AST of the translated files,
+// e.g. to rewrite gno-specific builtins. Pre and Post are the callbacks of
+// astutil.Apply, called before and after the children of each node: Pre
+// skips the children of the node by returning false, and Post aborts the
+// walk. The file itself must not be replaced.
+//
+// The imports are rewritten when the transformers run. The imports no longer
+// referred to are removed afterwards, if PruneUnusedImports is set, and
+// FixImports also adds the missing ones.
+type Transformer interface {
+	Pre(c *astutil.Cursor) bool
+	Post(c *astutil.Cursor) bool
+}
+
+// AddTransform registers t, to be applied after the built-in transformations
+// and the transformers registered before.
+func (opts *PrecompileOptions) AddTransform(t Transformer) {
+	opts.Transforms = append(opts.Transforms, t)
+}
+
+func (opts PrecompileOptions) rewriteRules() RewriteRules {
+	if len(opts.RewriteRules) == 0 {
+		return DefaultRewriteRules
+	}
+	return opts.RewriteRules
+}
+
+var goVersionRegexp = regexp.MustCompile(`^go1\.(0|[1-9][0-9]*)$`)
+
+func (opts PrecompileOptions) validateGoVersion() error {
+	if opts.GoVersion != "" && !goVersionRegexp.MatchString(opts.GoVersion) {
+		return fmt.Errorf("invalid go version %q: must be of the form go1.N", opts.GoVersion)
+	}
+	return nil
+}
+
+// WhitelistMode is how Precompile applies the import whitelist.
+type WhitelistMode int
+
+const (
+	// WhitelistEnforce fails the translation of the files importing
+	// packages that are not whitelisted.
+	WhitelistEnforce WhitelistMode = iota
+	// WhitelistWarn translates them anyway, and reports their imports as
+	// warning diagnostics.
+	WhitelistWarn
+	// WhitelistOff doesn't check the imports at all.
+	WhitelistOff
+)
+
+func (m WhitelistMode) String() string {
+	switch m {
+	case WhitelistEnforce:
+		return "enforce"
+	case WhitelistWarn:
+		return "warn"
+	case WhitelistOff:
+		return "off"
+	default:
+		return fmt.Sprintf("WhitelistMode(%d)", int(m))
+	}
+}
+
+// buildEnvEssentials are the environment variables inherited by the go
+// toolchain even with PrecompileOptions.BuildEnv.
+var buildEnvEssentials = []string{
+	"HOME",
+	"PATH",
+	"TMPDIR",
+	"GOCACHE",
+	"GOMODCACHE",
+	"GOPATH",
+	"XDG_CACHE_HOME",
+	// windows
+	"SYSTEMROOT",
+	"USERPROFILE",
+	"LOCALAPPDATA",
+}
+
+// buildEnv returns the environment of the commands of the go toolchain, or
+// nil to inherit the one of the process.
+func (opts PrecompileOptions) buildEnv() []string {
+	var env []string
+	switch {
+	case opts.BuildEnv != nil:
+		env = append(env, opts.BuildEnv...)
+		for _, key := range buildEnvEssentials {
+			set := false
+			for _, kv := range opts.BuildEnv {
+				if strings.HasPrefix(kv, key+"=") {
+					set = true
+					break
+				}
+			}
+			if value, ok := os.LookupEnv(key); ok && !set {
+				env = append(env, key+"="+value)
+			}
+		}
+	case opts.Offline:
+		env = os.Environ()
+	default:
+		return nil
+	}
+	if opts.Offline {
+		// the last value of a variable is the one used.
+		env = append(env, offlineEnv...)
+	}
+	return env
+}
+
+// offlineEnv are the variables of the go toolchain in offline mode.
+var offlineEnv = []string{"GOPROXY=off", "GOFLAGS=-mod=readonly"}
+
+// offlineError returns an error wrapping ErrOffline if out, the output of the
+// go toolchain, reports a module missing from the module cache or go.mod, or
+// nil otherwise.
+func offlineError(out []byte) error {
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, "lookup disabled by") ||
+			strings.Contains(line, "no required module provides package") ||
+			strings.Contains(line, "missing go.sum entry") {
+			return fmt.Errorf("%w: %s", ErrOffline, strings.TrimSpace(line))
+		}
+	}
+	return nil
+}
+
+// workDir returns the directory to which PrecompileMemPkg writes the
+// translated package, and a function removing it unless it is WorkDir.
+func (opts PrecompileOptions) workDir() (string, func(), error) {
+	if opts.WorkDir == "" {
+		dir, err := os.MkdirTemp("", "gno-precompile")
+		if err != nil {
+			return "", nil, err
+		}
+		return dir, func() {
+			os.RemoveAll(dir) //nolint: errcheck
+		}, nil
+	}
+
+	dir, err := filepath.Abs(opts.WorkDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("work dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, fmt.Errorf("work dir: %w", err)
+	}
+	if len(entries) > 0 {
+		return "", nil, fmt.Errorf("work dir %s is not empty", opts.WorkDir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", nil, fmt.Errorf("work dir: %w", err)
+	}
+	return dir, func() {}, nil
+}
+
+// goBuildFlags returns the flags of the go build and go test commands run
+// on the generated files.
+func (opts PrecompileOptions) goBuildFlags() []string {
+	if opts.GoVersion == "" {
+		return nil
+	}
+	return []string{"-gcflags=-lang=" + opts.GoVersion}
+}
+
+// header renders the generated-code header of the translation of srcPath.
+func (opts PrecompileOptions) header(srcPath string) (string, error) {
+	if opts.HeaderTemplate == "" {
+		return GeneratedHeader, nil
+	}
+
+	tmpl, err := template.New("header").Parse(opts.HeaderTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse header template: %w", err)
+	}
+	var out strings.Builder
+	err = tmpl.Execute(&out, struct {
+		SourcePath string
+		Timestamp  string
+	}{
+		SourcePath: srcPath,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("execute header template: %w", err)
+	}
+
+	header := strings.TrimRight(out.String(), "\n")
+	firstLine, _, _ := strings.Cut(header, "\n")
+	if !generatedHeaderRegexp.MatchString(firstLine) {
+		return "", fmt.Errorf("header %q doesn't start with %q", firstLine, generatedHeaderPrefix)
+	}
+	return header, nil
+}
+
 type precompileResult struct {
-	Imports    []*ast.ImportSpec
-	Translated string
+	Imports     []*ast.ImportSpec
+	Translated  string
+	Diagnostics []Diagnostic
+	// EmbedPatterns are the patterns of the //go:embed directives of the
+	// source, whose files must be copied next to the translation.
+	EmbedPatterns []string
+	// RealmState are the names of the package-level variables, sorted,
+	// in RealmMode.
+	RealmState []string
+	// AST is the transformed AST, printed in Translated after the header,
+	// and Fset the fileset of its positions, which are those of the .gno
+	// source. They are nil if the translation failed.
+	AST  ast.Node
+	Fset *token.FileSet
+	// Timings is the time spent parsing and translating the source.
+	Timings PrecompileTimings
+}
+
+// PrecompileTimings is the time spent in each phase of a precompilation.
+type PrecompileTimings struct {
+	Parse     time.Duration
+	Translate time.Duration
+	Verify    time.Duration
+	Build     time.Duration
+}
+
+// Add adds the timings of other to t.
+func (t *PrecompileTimings) Add(other PrecompileTimings) {
+	t.Parse += other.Parse
+	t.Translate += other.Translate
+	t.Verify += other.Verify
+	t.Build += other.Build
+}
+
+// Total returns the time spent in all the phases.
+func (t PrecompileTimings) Total() time.Duration {
+	return t.Parse + t.Translate + t.Verify + t.Build
+}
+
+// SourceMap returns the mapping from the lines of the translated source to
+// the lines of the original .gno source.
+func (r *precompileResult) SourceMap() (SourceMap, error) {
+	if r.AST == nil {
+		return nil, fmt.Errorf("no translated source")
+	}
+	return buildSourceMap(r.Fset, r.AST, r.Translated)
+}
+
+// DiagnosticSeverity is the severity of a Diagnostic.
+type DiagnosticSeverity int
+
+const (
+	SeverityError DiagnosticSeverity = iota
+	SeverityWarning
+)
+
+func (s DiagnosticSeverity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("DiagnosticSeverity(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the severity as its name, for JSON reports.
+func (s DiagnosticSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity encoded by MarshalText.
+func (s *DiagnosticSeverity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "error":
+		*s = SeverityError
+	case "warning":
+		*s = SeverityWarning
+	default:
+		return fmt.Errorf("invalid diagnostic severity %q", text)
+	}
+	return nil
+}
+
+// Diagnostic is a problem found in a .gno source while precompiling it,
+// located precisely enough for editors to highlight it.
+type Diagnostic struct {
+	Pos      token.Position
+	Msg      string
+	Severity DiagnosticSeverity
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+}
+
+// ErrTimeout is returned when a command of the go toolchain is killed because
+// it didn't complete in time.
+var ErrTimeout = errors.New("go toolchain timed out")
+
+// ErrOffline is returned in offline mode when the go toolchain needs a module
+// that is not available locally.
+var ErrOffline = errors.New("required module not available offline")
+
+// ErrGoNotFound is returned when the go binary to build with can't be found,
+// before running any command.
+var ErrGoNotFound = errors.New("go toolchain not found")
+
+// goBinaryPaths caches the paths resolved by LookGoBinary, by go binary and
+// $PATH.
+var goBinaryPaths sync.Map
+
+// LookGoBinary returns the absolute path of goBinary, "go" if empty, as
+// resolved by exec.LookPath. The error, wrapping ErrGoNotFound, tells how to
+// fix it, rather than the raw error of exec.
+func LookGoBinary(goBinary string) (string, error) {
+	if goBinary == "" {
+		goBinary = "go"
+	}
+	key := goBinary + "\x00" + os.Getenv("PATH")
+	if path, ok := goBinaryPaths.Load(key); ok {
+		return path.(string), nil
+	}
+
+	path, err := exec.LookPath(goBinary)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not an executable; set --go-binary or install Go", ErrGoNotFound, goBinary)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	goBinaryPaths.Store(key, path)
+	return path, nil
+}
+
+// PrecompileReport summarizes a precompilation run in a machine-readable
+// form, for the tools wrapping the precompiler.
+type PrecompileReport struct {
+	Files []PrecompileFileReport
+	Tests []PrecompileTestResult `json:",omitempty"`
+	// Output is the output of the program in the run mode of
+	// PrecompileMemPkg.
+	Output string `json:",omitempty"`
+}
+
+// PrecompileFileReport is the outcome of the precompilation of a .gno file.
+type PrecompileFileReport struct {
+	SourcePath  string
+	TargetPath  string       `json:",omitempty"`
+	Written     bool         // false in dry-run mode.
+	Diagnostics []Diagnostic `json:",omitempty"`
+	Error       string       `json:",omitempty"`
+}
+
+// PrecompileTestResult is the result of a test run in the test mode of
+// PrecompileMemPkg.
+type PrecompileTestResult struct {
+	Name   string
+	Passed bool
+	Output string `json:",omitempty"`
+}
+
+// WriteJSON writes the report to w as indented JSON.
+func (r *PrecompileReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ImportNotWhitelistedError is returned by Precompile for each import that is
+// not allowed in a .gno file.
+type ImportNotWhitelistedError struct {
+	ImportPath string
+	Position   token.Position
+	// Suggestion is the whitelisted import nearest to ImportPath, if it is
+	// close enough to likely be a typo.
+	Suggestion string
+}
+
+func (e *ImportNotWhitelistedError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("import %q is not in the whitelist, did you mean %q?", e.ImportPath, e.Suggestion)
+	}
+	return fmt.Sprintf("import %q is not in the whitelist", e.ImportPath)
+}
+
+// suggestWhitelistedImport returns the whitelisted import nearest to
+// importPath by Levenshtein distance, or "" if none is close enough. The
+// tolerated distance grows with the length of importPath, up to 2, so that
+// short paths get no noisy suggestions.
+func suggestWhitelistedImport(importPath string) string {
+	maxDist := len(importPath) / 4
+	if maxDist > 2 {
+		maxDist = 2
+	}
+
+	suggestion, bestDist := "", maxDist+1
+	for _, whitelisted := range stdlibWhitelist {
+		if dist := levenshtein(importPath, whitelisted); dist < bestDist {
+			suggestion, bestDist = whitelisted, dist
+		}
+	}
+	return suggestion
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// NotWhitelistedImports returns the sorted and deduplicated paths of all the
+// ImportNotWhitelistedError contained in err, which may be a (wrapped)
+// combination of errors.
+func NotWhitelistedImports(err error) []string {
+	seen := map[string]struct{}{}
+	collectNotWhitelistedImports(err, seen)
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func collectNotWhitelistedImports(err error, seen map[string]struct{}) {
+	if errs := multierr.Errors(err); len(errs) > 1 {
+		for _, err := range errs {
+			collectNotWhitelistedImports(err, seen)
+		}
+		return
+	}
+	if e, ok := err.(*ImportNotWhitelistedError); ok {
+		seen[e.ImportPath] = struct{}{}
+		return
+	}
+	if inner := errors.Unwrap(err); inner != nil {
+		collectNotWhitelistedImports(inner, seen)
+	}
 }
 
-// TODO: func PrecompileFile: supports caching.
 // TODO: func PrecompilePkg: supports directories.
 
-func guessRootDir(fileOrPkg string, goBinary string) (string, error) {
+// guessRootDir returns the directory of github.com/gnolang/gno in the module
+// of the directory fileOrPkg, as listed by go list. If the directory is not
+// in a module requiring it, e.g. a standalone realm, it returns the root of
+// the nearest module above the directory instead, which has to resolve the
+// gno imports itself, e.g. with a replace directive.
+func guessRootDir(ctx context.Context, fileOrPkg string, goBinary string, opts PrecompileOptions) (string, error) {
 	abs, err := filepath.Abs(fileOrPkg)
 	if err != nil {
 		return "", err
 	}
-	args := []string{"list", "-m", "-mod=mod", "-f", "{{.Dir}}", ImportPrefix}
-	cmd := exec.Command(goBinary, args...)
-	cmd.Dir = abs
+	if rootDir, err := listGnoRootDir(ctx, abs, goBinary, opts); err == nil {
+		return rootDir, nil
+	}
+	if rootDir, ok := findModuleRoot(abs); ok {
+		return rootDir, nil
+	}
+	return "", fmt.Errorf("can't guess the root dir of %s: not in a module requiring %s, nor in any module; set the root dir explicitly", fileOrPkg, ImportPrefix)
+}
+
+// listGnoRootDir returns the directory of github.com/gnolang/gno in the module
+// of dir, as listed by go list with the environment of opts.
+func listGnoRootDir(ctx context.Context, dir string, goBinary string, opts PrecompileOptions) (string, error) {
+	mod := "-mod=mod"
+	if opts.Offline {
+		mod = "-mod=readonly"
+	}
+	args := []string{"list", "-m", mod, "-f", "{{.Dir}}", ImportPrefix}
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	cmd.Dir = dir
+	cmd.Env = opts.buildEnv()
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("can't guess --root-dir")
+		return "", fmt.Errorf("go list: %w\n%s", err, out)
 	}
 	rootDir := strings.TrimSpace(string(out))
+	if rootDir == "" {
+		return "", fmt.Errorf("go list: no directory for %s", ImportPrefix)
+	}
 	return rootDir, nil
 }
 
+// findModuleRoot returns the closest directory containing a go.mod, from dir
+// up to the root of the filesystem.
+func findModuleRoot(dir string) (string, bool) {
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !info.IsDir() {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// OutputNaming returns the name of the .go file translated from the .gno file
+// named gnoFilename, without its directory.
+type OutputNaming func(gnoFilename string) string
+
+// GeneratedOutputNaming is the default OutputNaming, of
+// GetPrecompileFilenameAndTags: foo.gno is translated to foo.gno.gen.go,
+// and the tests and filetests to hidden files.
+func GeneratedOutputNaming(gnoFilename string) string {
+	targetFilename, _ := GetPrecompileFilenameAndTags(gnoFilename)
+	return targetFilename
+}
+
+// PureOutputNaming translates foo.gno to foo.go and foo_test.gno to
+// foo_test.go, for the tools expecting plain .go files. The filetests, which
+// are main packages, are still hidden, so that they are not built along
+// with the package: foo_filetest.gno is translated to .foo_filetest.go.
+func PureOutputNaming(gnoFilename string) string {
+	name := strings.TrimSuffix(filepath.Base(gnoFilename), ".gno") + ".go"
+	if strings.HasSuffix(gnoFilename, "_filetest.gno") {
+		return "." + name
+	}
+	return name
+}
+
+// targetFilename returns the name of the translation of the .gno file at
+// gnoFilePath, with GeneratedOutputNaming if n is nil.
+func (n OutputNaming) targetFilename(gnoFilePath string) string {
+	if n == nil {
+		return GeneratedOutputNaming(gnoFilePath)
+	}
+	return n(filepath.Base(gnoFilePath))
+}
+
 // GetPrecompileFilenameAndTags returns the filename and tags for precompiled files.
 func GetPrecompileFilenameAndTags(gnoFilePath string) (targetFilename, tags string) {
 	nameNoExtension := strings.TrimSuffix(filepath.Base(gnoFilePath), ".gno")
@@ -108,9 +921,13 @@ func GetPrecompileFilenameAndTags(gnoFilePath string) (targetFilename, tags stri
 }
 
 func PrecompileAndCheckMempkg(mempkg *std.MemPackage) error {
-	gofmt := "gofmt"
+	// the file names are joined to the temporary directory below.
+	if err := ValidateMemPackage(mempkg); err != nil {
+		return err
+	}
 
-	tmpDir, err := ioutil.TempDir("", mempkg.Name)
+	// mempkg.Name may not be set yet, e.g. for an anonymous main package.
+	tmpDir, err := os.MkdirTemp("", "gno-precompile-"+mempkg.Name)
 	if err != nil {
 		return err
 	}
@@ -132,7 +949,7 @@ func PrecompileAndCheckMempkg(mempkg *std.MemPackage) error {
 			errs = multierr.Append(errs, err)
 			continue
 		}
-		err = PrecompileVerifyFile(tmpFile, gofmt)
+		err = PrecompileVerifyFile(tmpFile, "")
 		if err != nil {
 			errs = multierr.Append(errs, err)
 			continue
@@ -140,134 +957,1249 @@ func PrecompileAndCheckMempkg(mempkg *std.MemPackage) error {
 	}
 
 	if errs != nil {
+		if imports := NotWhitelistedImports(errs); len(imports) > 0 {
+			return fmt.Errorf("precompile package: %w\nimports not in the whitelist: %s", errs, strings.Join(imports, ", "))
+		}
 		return fmt.Errorf("precompile package: %w", errs)
 	}
 	return nil
 }
 
+// ValidateMemPackage returns an error if the files of mempkg can't make a
+// package to precompile: it must have at least a .gno file, and its files
+// must have unique, plain and non-hidden names. The other files, such as
+// go files, are allowed but ignored. The name and path of mempkg are not
+// checked, as they may not be set yet, e.g. for an anonymous main package;
+// see std.MemPackage.Validate.
+func ValidateMemPackage(mempkg *std.MemPackage) error {
+	if mempkg == nil {
+		return errors.New("invalid package: nil package")
+	}
+	names := map[string]bool{}
+	hasGnoFile := false
+	for _, mfile := range mempkg.Files {
+		if err := validateMemFileName(mfile.Name); err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(mfile.Name, "."):
+			return fmt.Errorf("invalid file name %q: must not be hidden", mfile.Name)
+		case names[mfile.Name]:
+			return fmt.Errorf("duplicate file name %q", mfile.Name)
+		}
+		names[mfile.Name] = true
+		if strings.HasSuffix(mfile.Name, ".gno") {
+			hasGnoFile = true
+		}
+	}
+	if !hasGnoFile {
+		return errors.New("invalid package: no .gno files")
+	}
+	return nil
+}
+
+// validateMemFileName returns an error if the name of a MemFile is not a
+// plain file name, which could be used to write outside of a directory.
+func validateMemFileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid file name %q: must not be empty, \".\", \"..\" nor contain path separators", name)
+	}
+	return nil
+}
+
+// PrecompileMemPkg precompiles the .gno files of mempkg in memory, and
+// returns a report of the translation of each file, along with an error
+// combining the errors of all the files.
+//
+// If opts.Gobuild is set, the translated package is then written to a
+// temporary directory to be built. If opts.Test is set, it is tested instead,
+// and the report contains the test results; the filetests are not run. If
+// opts.Run is set, it is run instead, and the report contains its output.
+func PrecompileMemPkg(mempkg *std.MemPackage, opts PrecompileOptions) (*PrecompileReport, error) {
+	if err := ValidateMemPackage(mempkg); err != nil {
+		return nil, err
+	}
+
+	if opts.Test {
+		// go test runs the tests with the testing package of go, not the
+		// one of gno.
+		opts.RewriteRules = opts.rewriteRules().without(gnoTestingPkgBefore)
+	}
+
+	report := &PrecompileReport{}
+	var translations []memPkgTranslation
+	var errs error
+	for _, mfile := range mempkg.Files {
+		if !strings.HasSuffix(mfile.Name, ".gno") {
+			continue // skip spurious file.
+		}
+		_, tags := GetPrecompileFilenameAndTags(mfile.Name)
+		targetFilename := opts.OutputNaming.targetFilename(mfile.Name)
+		if opts.Test && strings.HasSuffix(mfile.Name, "_test.gno") {
+			// the go toolchain ignores the hidden files.
+			targetFilename = strings.TrimPrefix(targetFilename, ".")
+		}
+		fileReport := PrecompileFileReport{
+			SourcePath: mfile.Name,
+			TargetPath: targetFilename,
+		}
+		res, err := PrecompileWithOptions(mfile.Body, tags, mfile.Name, opts)
+		if res != nil {
+			fileReport.Diagnostics = res.Diagnostics
+		}
+		if err != nil {
+			fileReport.Error = err.Error()
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", mfile.Name, err))
+		} else {
+			translations = append(translations, memPkgTranslation{
+				srcName:    mfile.Name,
+				targetName: targetFilename,
+				res:        res,
+			})
+		}
+		report.Files = append(report.Files, fileReport)
+	}
+	if errs != nil {
+		return report, fmt.Errorf("precompile package: %w", errs)
+	}
+
+	if opts.Gobuild || opts.Test || opts.Run {
+		// report the cycles introduced by the rewriting with the gno paths,
+		// rather than with the go paths in the error of go build.
+		if err := CheckImportCycles([]*std.MemPackage{mempkg}, opts.rewriteRules()); err != nil {
+			return report, fmt.Errorf("build package: %w", err)
+		}
+		err := buildMemPkgSources(mempkg, translations, opts, report)
+		if err != nil && opts.Test {
+			return report, fmt.Errorf("test package: %w", err)
+		}
+		if err != nil && opts.Run {
+			return report, fmt.Errorf("run package: %w", err)
+		}
+		if err != nil {
+			return report, fmt.Errorf("build package: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// memPkgTranslation is the translation of a .gno file of a MemPackage.
+type memPkgTranslation struct {
+	srcName    string
+	targetName string
+	res        *precompileResult
+}
+
+// buildMemPkgSources writes the translated sources of mempkg to a temporary
+// module, and builds it, or runs its tests in test mode, or runs it in run
+// mode, reporting the results in report. The errors point to the .gno
+// sources.
+func buildMemPkgSources(mempkg *std.MemPackage, translations []memPkgTranslation, opts PrecompileOptions, report *PrecompileReport) error {
+	goBinary, err := LookGoBinary(opts.GoBinary)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if opts.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.RunTimeout)
+		defer cancel()
+	}
+
+	rootDir := opts.RootDir
+	if rootDir == "" {
+		// without a clone of gno, only the packages without gno imports
+		// build; the root of another module would not resolve them.
+		rootDir, _ = listGnoRootDir(ctx, ".", goBinary, opts)
+	}
+
+	tmpDir, cleanup, err := opts.workDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	modulePath := mempkg.Path
+	if modulePath == "" {
+		// the anonymous main packages, which ValidateMemPackage allows,
+		// still need a module path.
+		modulePath = anonymousModulePath
+	}
+	if err := writeTempGoMod(tmpDir, modulePath, rootDir); err != nil {
+		return fmt.Errorf("write go.mod: %w", err)
+	}
+	var embedPatterns []string
+	for _, tr := range translations {
+		if err := os.WriteFile(filepath.Join(tmpDir, tr.targetName), []byte(tr.res.Translated), 0o644); err != nil {
+			return err
+		}
+		embedPatterns = append(embedPatterns, tr.res.EmbedPatterns...)
+	}
+	if err := writeMemPkgAssets(mempkg, embedPatterns, tmpDir); err != nil {
+		return err
+	}
+
+	if opts.Test {
+		tests, err := runMemPkgTests(ctx, goBinary, tmpDir, translations, opts)
+		report.Tests = tests
+		return err
+	}
+	if opts.Run {
+		output, err := runMemPkg(ctx, goBinary, tmpDir, translations, opts)
+		report.Output = output
+		return err
+	}
+
+	// build from the temporary module itself: its gno dependency is
+	// replaced by rootDir, which would otherwise be guessed as the root.
+	args := append([]string{"build", "-v", "-tags=gno"}, opts.goBuildFlags()...)
+	cmd := exec.CommandContext(ctx, goBinary, append(args, ".")...)
+	cmd.Dir = tmpDir
+	cmd.Env = opts.buildEnv()
+	out, err := streamCombinedOutput(cmd, opts.Stdout, opts.Stderr)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	if err != nil {
+		if offlineErr := offlineError(out); opts.Offline && offlineErr != nil {
+			return offlineErr
+		}
+		return fmt.Errorf("std go compiler: %w\n%s", err, rewriteTempPaths(string(out), tmpDir, translations))
+	}
+	return nil
+}
+
+// writeMemPkgAssets writes the files of mempkg embedded with the given
+// //go:embed patterns to dir.
+func writeMemPkgAssets(mempkg *std.MemPackage, embedPatterns []string, dir string) error {
+	if len(embedPatterns) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(mempkg.Files))
+	for i, mfile := range mempkg.Files {
+		names[i] = mfile.Name
+	}
+	assets, err := MatchEmbedPatterns(embedPatterns, names)
+	if err != nil {
+		return fmt.Errorf("embed: %w", err)
+	}
+	for _, asset := range assets {
+		mfile := mempkg.GetFile(asset)
+		if err := os.WriteFile(filepath.Join(dir, asset), []byte(mfile.Body), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamCombinedOutput runs cmd and returns its combined output, like
+// cmd.CombinedOutput, while copying its stdout and stderr to the given
+// writers, if not nil, as they are written.
+func streamCombinedOutput(cmd *exec.Cmd, stdout, stderr io.Writer) ([]byte, error) {
+	if stdout == nil && stderr == nil {
+		return cmd.CombinedOutput()
+	}
+
+	out := &lockedBuffer{}
+	cmd.Stdout, cmd.Stderr = out, out
+	if stdout != nil {
+		cmd.Stdout = io.MultiWriter(out, stdout)
+	}
+	if stderr != nil {
+		cmd.Stderr = io.MultiWriter(out, stderr)
+	}
+	err := cmd.Run()
+	return out.Bytes(), err
+}
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of the
+// stdout and stderr of a command.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
+
+// runMemPkg runs the translated main package in tmpDir with go run, and
+// returns its output, with the temporary paths rewritten to the .gno sources.
+func runMemPkg(ctx context.Context, goBinary string, tmpDir string, translations []memPkgTranslation, opts PrecompileOptions) (string, error) {
+	args := append([]string{"run", "-tags=gno"}, opts.goBuildFlags()...)
+	args = append(append(args, "."), opts.Args...)
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	cmd.Dir = tmpDir
+	cmd.Env = opts.buildEnv()
+	cmd.Stdin = opts.Stdin
+	out, err := streamCombinedOutput(cmd, opts.Stdout, opts.Stderr)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", ErrTimeout
+	}
+	output := rewriteTempPaths(string(out), tmpDir, translations)
+	if err != nil {
+		if offlineErr := offlineError(out); opts.Offline && offlineErr != nil {
+			return output, offlineErr
+		}
+		return output, fmt.Errorf("go run: %w\n%s", err, output)
+	}
+	return output, nil
+}
+
+// runMemPkgTests runs go test on the translated package in tmpDir, and
+// returns the results of its tests.
+func runMemPkgTests(ctx context.Context, goBinary string, tmpDir string, translations []memPkgTranslation, opts PrecompileOptions) ([]PrecompileTestResult, error) {
+	args := append([]string{"test", "-json", "-tags=gno,test"}, opts.goBuildFlags()...)
+	cmd := exec.CommandContext(ctx, goBinary, append(args, ".")...)
+	cmd.Dir = tmpDir
+	cmd.Env = opts.buildEnv()
+	out, err := streamCombinedOutput(cmd, opts.Stdout, opts.Stderr)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+
+	results, otherOutput := parseGoTestJSON(string(out))
+	for i := range results {
+		results[i].Output = rewriteTempPaths(results[i].Output, tmpDir, translations)
+	}
+	otherOutput = rewriteTempPaths(otherOutput, tmpDir, translations)
+	if err != nil && len(results) == 0 {
+		// the tests didn't run.
+		if offlineErr := offlineError(out); opts.Offline && offlineErr != nil {
+			return nil, offlineErr
+		}
+		return nil, fmt.Errorf("std go compiler: %w\n%s", err, otherOutput)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	if err != nil {
+		return results, fmt.Errorf("go test: %w\n%s", err, otherOutput)
+	}
+	return results, nil
+}
+
+// parseGoTestJSON parses the output of go test -json, and returns the results
+// of the top-level tests in their order of completion, along with the output
+// that is not related to a test.
+func parseGoTestJSON(out string) ([]PrecompileTestResult, string) {
+	var (
+		results     []PrecompileTestResult
+		outputs     = map[string]*strings.Builder{}
+		otherOutput strings.Builder
+	)
+	for _, line := range strings.SplitAfter(out, "\n") {
+		var event struct {
+			Action string
+			Test   string
+			Output string
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			otherOutput.WriteString(line) // build errors are not always events.
+			continue
+		}
+		if event.Test == "" {
+			if event.Action == "output" || event.Action == "build-output" {
+				otherOutput.WriteString(event.Output)
+			}
+			continue
+		}
+
+		// the subtests are reported along with their top-level test.
+		name, _, isSubtest := strings.Cut(event.Test, "/")
+		switch {
+		case event.Action == "output":
+			if outputs[name] == nil {
+				outputs[name] = &strings.Builder{}
+			}
+			outputs[name].WriteString(event.Output)
+		case isSubtest:
+			// only the output of the subtests is kept.
+		case event.Action == "pass", event.Action == "fail":
+			result := PrecompileTestResult{
+				Name:   event.Test,
+				Passed: event.Action == "pass",
+			}
+			if output := outputs[event.Test]; output != nil {
+				result.Output = output.String()
+			}
+			results = append(results, result)
+		}
+	}
+	return results, otherOutput.String()
+}
+
+// rewriteTempPaths rewrites the locations in the generated files found in
+// out, the output of the go toolchain run in tmpDir, to the locations in their
+// .gno sources, and strips tmpDir from the remaining paths.
+func rewriteTempPaths(out string, tmpDir string, translations []memPkgTranslation) string {
+	for _, tr := range translations {
+		sm, err := tr.res.SourceMap()
+		if err != nil {
+			continue
+		}
+		// the go toolchain prints either absolute paths, or paths relative
+		// to the directory it runs in.
+		out = sm.RewriteLines(out, filepath.Join(tmpDir, tr.targetName), tr.srcName)
+		out = sm.RewriteLines(out, "."+string(filepath.Separator)+tr.targetName, tr.srcName)
+		// go test prints the bare file names in the test logs.
+		out = sm.RewriteLines(out, " "+tr.targetName, " "+tr.srcName)
+	}
+	return strings.ReplaceAll(out, tmpDir+string(filepath.Separator), "")
+}
+
+// anonymousModulePath is the module path of the temporary module of a
+// MemPackage without a path.
+const anonymousModulePath = "gno.land/r/main"
+
+// writeTempGoMod writes to dir the go.mod of a temporary module, so that the
+// rewritten gno imports resolve to the clone of github.com/gnolang/gno at
+// rootDir, along with its go.sum. Only a bare module is written if rootDir is
+// empty.
+func writeTempGoMod(dir string, modulePath string, rootDir string) error {
+	goMod := fmt.Sprintf("module %s\n\ngo 1.19\n", modulePath)
+	if rootDir == "" {
+		return os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644)
+	}
+
+	absRootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return err
+	}
+	goMod += fmt.Sprintf("\nrequire %s v0.0.0\n\nreplace %s => %s\n", ImportPrefix, ImportPrefix, absRootDir)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		return err
+	}
+
+	goSum, err := os.ReadFile(filepath.Join(absRootDir, "go.sum"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "go.sum"), goSum, 0o644)
+}
+
+// PrecompileMempkgToSources precompiles the .gno files of mempkg and returns
+// the translated sources keyed by their target filename, without any disk
+// I/O.
+func PrecompileMempkgToSources(mempkg *std.MemPackage) (map[string]string, error) {
+	sources := map[string]string{}
+
+	var errs error
+	for _, mfile := range mempkg.Files {
+		if !strings.HasSuffix(mfile.Name, ".gno") {
+			continue // skip spurious file.
+		}
+		targetFilename, tags := GetPrecompileFilenameAndTags(mfile.Name)
+		res, err := Precompile(mfile.Body, tags, mfile.Name)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", mfile.Name, err))
+			continue
+		}
+		sources[targetFilename] = res.Translated
+	}
+
+	if errs != nil {
+		return nil, fmt.Errorf("precompile package: %w", errs)
+	}
+	return sources, nil
+}
+
+// Precompile translates a .gno source to go, using the default options.
 func Precompile(source string, tags string, filename string) (*precompileResult, error) {
+	return PrecompileWithOptions(source, tags, filename, DefaultPrecompileOptions())
+}
+
+// PrecompileWithOptions translates a .gno source to go. The generated header
+// is omitted if tags is NoHeaderTags.
+func PrecompileWithOptions(source string, tags string, filename string, opts PrecompileOptions) (*precompileResult, error) {
+	return PrecompileWithFset(token.NewFileSet(), source, tags, filename, opts)
+}
+
+// PrecompileWithFset is like PrecompileWithOptions, but adds the source to
+// the given fset instead of a new one, so that the positions of the
+// diagnostics of several files, e.g. of a package, are in the same fset.
+func PrecompileWithFset(fset *token.FileSet, source string, tags string, filename string, opts PrecompileOptions) (*precompileResult, error) {
 	var out bytes.Buffer
 
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, "tmp.gno", source, parser.ParseComments)
+	if err := opts.rewriteRules().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rewrite rules: %w", err)
+	}
+	if err := opts.validateGoVersion(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	f, err := parser.ParseFile(fset, filename, source, parser.ParseComments)
 	if err != nil {
 		return nil, fmt.Errorf("parse: %w", err)
 	}
+	parsed := time.Now()
+
+	embedPatterns, err := EmbedPatterns(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// the build constraint of the source is merged into the header.
+	srcConstraint, err := removeBuildConstraint(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
 
 	isTestFile := strings.HasSuffix(filename, "_test.gno") || strings.HasSuffix(filename, "_filetest.gno")
 	shouldCheckWhitelist := !isTestFile
 
-	transformed, err := precompileAST(fset, f, shouldCheckWhitelist)
+	var realmState []string
+	if opts.RealmMode {
+		realmState = annotateRealmState(f)
+	}
+
+	transformed, diags, err := precompileAST(fset, f, shouldCheckWhitelist, opts)
+	if err != nil {
+		// return the diagnostics along with the error, so that callers can
+		// report their positions.
+		res := &precompileResult{
+			Imports:     f.Imports,
+			Diagnostics: diags,
+		}
+		return res, fmt.Errorf("%w", err)
+	}
+	// gno can't import embed, which is not whitelisted for the packages on
+	// chain, but go requires it for the //go:embed directives, whose files
+	// are copied along with the translation.
+	if len(embedPatterns) > 0 {
+		astutil.AddNamedImport(fset, f, "_", "embed")
+	}
+
+	if tags != NoHeaderTags {
+		header, err := opts.header(filename)
+		if err != nil {
+			return nil, err
+		}
+		header += "\n\n"
+		if opts.GoVersion != "" {
+			tags = strings.TrimPrefix(tags+","+opts.GoVersion, ",")
+		}
+		constraintLines, err := buildConstraintLines(tags, srcConstraint)
+		if err != nil {
+			return nil, err
+		}
+		if len(constraintLines) > 0 {
+			header += strings.Join(constraintLines, "\n") + "\n\n"
+		}
+		_, err = out.WriteString(header)
+		if err != nil {
+			return nil, fmt.Errorf("write to buffer: %w", err)
+		}
+	}
+	// transformed is the *ast.File, so that its comments, including the
+	// floating ones, are printed along with the nodes.
+	err = format.Node(&out, fset, transformed)
+	if err != nil {
+		return nil, fmt.Errorf("format: %w", err)
+	}
+
+	res := &precompileResult{
+		Imports:       f.Imports,
+		Translated:    out.String(),
+		Diagnostics:   diags,
+		EmbedPatterns: embedPatterns,
+		RealmState:    realmState,
+		AST:           transformed,
+		Fset:          fset,
+		Timings: PrecompileTimings{
+			Parse:     parsed.Sub(start),
+			Translate: time.Since(parsed),
+		},
+	}
+	return res, nil
+}
+
+// removeBuildConstraint removes the //go:build and // +build lines of f, and
+// returns the constraint they express, or nil if there is none.
+func removeBuildConstraint(f *ast.File) (constraint.Expr, error) {
+	var goBuild, plusBuild constraint.Expr
+	comments := f.Comments[:0]
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			comments = append(comments, cg)
+			continue
+		}
+		list := cg.List[:0]
+		for _, c := range cg.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				list = append(list, c)
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid build constraint %q: %w", c.Text, err)
+			}
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				goBuild = expr
+			case plusBuild == nil:
+				plusBuild = expr
+			default:
+				// multiple +build lines are and-ed.
+				plusBuild = &constraint.AndExpr{X: plusBuild, Y: expr}
+			}
+		}
+		cg.List = list
+		if len(list) > 0 {
+			comments = append(comments, cg)
+		}
+	}
+	f.Comments = comments
+
+	// as for the go toolchain, //go:build takes precedence over +build.
+	if goBuild != nil {
+		return goBuild, nil
+	}
+	return plusBuild, nil
+}
+
+// buildConstraintLines returns the //go:build and // +build lines requiring
+// all of the comma-separated tags, and the constraint of the source, if any.
+func buildConstraintLines(tags string, srcConstraint constraint.Expr) ([]string, error) {
+	var expr constraint.Expr
+	for _, tag := range strings.Split(tags, ",") {
+		if tag == "" {
+			continue
+		}
+		tagExpr := &constraint.TagExpr{Tag: tag}
+		if expr == nil {
+			expr = tagExpr
+		} else {
+			expr = &constraint.AndExpr{X: expr, Y: tagExpr}
+		}
+	}
+	switch {
+	case expr == nil:
+		expr = srcConstraint
+	case srcConstraint != nil:
+		expr = &constraint.AndExpr{X: expr, Y: srcConstraint}
+	}
+	if expr == nil {
+		return nil, nil
+	}
+
+	plusLines, err := constraint.PlusBuildLines(expr)
+	if err != nil {
+		return nil, fmt.Errorf("build constraint: %w", err)
+	}
+	return append([]string{"//go:build " + expr.String()}, plusLines...), nil
+}
+
+// PrecompileSource reads a .gno source from r and writes its translation to
+// w. filename is only used to report errors and to compute the build tags.
+//
+// The translation is not checked with gofmt, since there is no file to check.
+func PrecompileSource(r io.Reader, w io.Writer, filename string, opts PrecompileOptions) error {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	_, err = PrecompileFileToWriter(source, filename, w, opts)
+	return err
+}
+
+// PrecompileFileToWriter translates the .gno source src, read from srcPath,
+// and writes the translation to w. It returns the import paths of the
+// translation, after the rewrite rules are applied. srcPath is only used to
+// report errors and to compute the build tags, so that the source doesn't
+// need to be on disk.
+func PrecompileFileToWriter(src []byte, srcPath string, w io.Writer, opts PrecompileOptions) ([]string, error) {
+	_, tags := GetPrecompileFilenameAndTags(srcPath)
+	res, err := PrecompileWithOptions(string(src), tags, srcPath, opts)
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
-
-	header := "// Code generated by github.com/gnolang/gno. DO NOT EDIT.\n\n"
-	if tags != "" {
-		header += "//go:build " + tags + "\n// +build " + tags + "\n\n"
+
+	importPaths := make([]string, 0, len(res.Imports))
+	for _, spec := range res.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid import path %s: %w", spec.Path.Value, err)
+		}
+		importPaths = append(importPaths, path)
+	}
+
+	_, err = io.WriteString(w, res.Translated)
+	if err != nil {
+		return nil, fmt.Errorf("write: %w", err)
+	}
+	return importPaths, nil
+}
+
+// PrecompileFile translates the .gno file at srcPath to the .go file next to
+// it, named by opts.OutputNaming, and returns the path of the .go file. The
+// file is written to opts.OutputFS if set.
+func PrecompileFile(srcPath string, opts PrecompileOptions) (string, error) {
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", fmt.Errorf("read: %w", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := PrecompileFileToWriter(src, srcPath, &out, opts); err != nil {
+		return "", err
+	}
+
+	targetFilename := opts.OutputNaming.targetFilename(srcPath)
+	targetPath := filepath.Join(filepath.Dir(srcPath), targetFilename)
+	translated := out.Bytes()
+	if opts.OnFile != nil {
+		translated, err = opts.OnFile(srcPath, targetPath, translated)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", srcPath, err)
+		}
+	}
+	if err := opts.outputFS().WriteFile(targetPath, translated, 0o644); err != nil {
+		return "", fmt.Errorf("write: %w", err)
+	}
+	return targetPath, nil
+}
+
+// OutputFS is a filesystem to which the .go files are written, as by
+// PrecompileOptions.OutputFS.
+type OutputFS interface {
+	// WriteFile writes data to the file name, creating it with perm if
+	// needed, as os.WriteFile does.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// OSOutputFS is the default OutputFS, which writes to the OS filesystem.
+// The files are written to a temporary file renamed into place, so that
+// they are never seen half-written, nor truncated by a failed write.
+type OSOutputFS struct{}
+
+func (OSOutputFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return writeFileAtomic(name, data, perm)
+}
+
+func (opts PrecompileOptions) outputFS() OutputFS {
+	if opts.OutputFS == nil {
+		return OSOutputFS{}
+	}
+	return opts.OutputFS
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// to path, so that path is never seen half-written, nor truncated by a failed
+// write.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // once renamed, there is nothing to remove.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
 	}
-	_, err = out.WriteString(header)
+	return os.Rename(tmp.Name(), path)
+}
+
+// IsGeneratedFile reports whether the file at path was generated by
+// Precompile, by reading its first line only.
+func IsGeneratedFile(path string) (bool, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("write to buffer: %w", err)
+		return false, err
 	}
-	err = format.Node(&out, fset, transformed)
+	defer f.Close()
 
-	res := &precompileResult{
-		Imports:    f.Imports,
-		Translated: out.String(),
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
 	}
-	return res, nil
+	return generatedHeaderRegexp.MatchString(strings.TrimRight(line, "\r\n")), nil
+}
+
+// CleanGeneratedFiles removes the .go files generated by Precompile in dir.
+// Other .go files, including hand-written ones, are left untouched.
+func CleanGeneratedFiles(dir string) error {
+	_, err := PrecompileClean(dir, false)
+	return err
+}
+
+// PrecompileClean removes the .go files generated by Precompile in root, and
+// in its non-hidden subdirectories if recursive is set, and returns their
+// paths. The files are recognized by their generated-code
+// header, so that hand-written .go files are left untouched.
+func PrecompileClean(root string, recursive bool) ([]string, error) {
+	var removed []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		generated, err := IsGeneratedFile(path)
+		if err != nil {
+			return err
+		}
+		if !generated {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed = append(removed, path)
+		return nil
+	})
+	return removed, err
 }
 
 // PrecompileVerifyFile tries to run `go fmt` against a precompiled .go file.
+// If gofmtBinary is empty, the file is checked in-process instead: it must
+// parse, and be formatted as go/format does.
 //
 // This is fast and won't look the imports.
 func PrecompileVerifyFile(path string, gofmtBinary string) error {
-	// TODO: use cmd/parser instead of exec?
+	if gofmtBinary == "" {
+		return verifyFileFormat(path)
+	}
 
 	args := strings.Split(gofmtBinary, " ")
 	args = append(args, []string{"-l", "-e", path}...)
 	cmd := exec.Command(args[0], args[1:]...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, string(out))
-		return fmt.Errorf("%s: %w", gofmtBinary, err)
+		return fmt.Errorf("%s: %w\n%s", gofmtBinary, err, out)
+	}
+	return nil
+}
+
+// verifyFileFormat checks in-process that the .go file at path parses, and
+// is left unchanged by go/format.
+func verifyFileFormat(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("gofmt: %w", err)
+	}
+	if !bytes.Equal(src, formatted) {
+		return fmt.Errorf("gofmt: %s is not formatted", path)
+	}
+	return nil
+}
+
+// PrecompileVetFile tries to run `go vet` against a precompiled .go file,
+// using the given build tags.
+//
+// Unlike PrecompileVerifyFile, this type-checks the file, so all the imports
+// have to be available. Hidden files, as generated for tests, are ignored by
+// the go toolchain and are not vetted.
+func PrecompileVetFile(path string, tags string, goBinary string) error {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return nil
+	}
+
+	goBinary, err := LookGoBinary(goBinary)
+	if err != nil {
+		return err
+	}
+	args := []string{"vet", "-tags=" + tags, path}
+	cmd := exec.Command(goBinary, args...)
+	rootDir, err := guessRootDir(context.Background(), filepath.Dir(path), goBinary, PrecompileOptions{})
+	if err == nil {
+		cmd.Dir = rootDir
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("go vet: %w\n%s", err, out)
 	}
 	return nil
 }
 
-// PrecompileBuildPackage tries to run `go build` against the precompiled .go files.
+// PrecompileBuildPackage tries to run `go build` against the precompiled .go
+// files of a package, or of the package containing a precompiled .go file.
+//
+// The whole package is built, so that the references between its files are
+// resolved. Test files are excluded by their build tags, like the go toolchain
+// does. The other generated files must be built with the gno tag only, so
+// that the package is not checked without some of them.
 //
 // This method is the most efficient to detect errors but requires that
 // all the import are valid and available.
+//
+// The error is based on the exit status of the go toolchain, not on its
+// output: if it fails, the returned error is a *BuildError wrapping its
+// *exec.ExitError, from which callers can get the exit code. Its Diagnostics
+// locate the errors of the output in the .gno sources.
 func PrecompileBuildPackage(fileOrPkg string, goBinary string) error {
+	return PrecompileBuildPackageContext(context.Background(), fileOrPkg, goBinary)
+}
+
+// PrecompileBuildPackageContext is like PrecompileBuildPackage, but kills the
+// go toolchain if ctx is done before the build ends; it then returns
+// ErrTimeout if the deadline of ctx was exceeded, or ctx.Err().
+func PrecompileBuildPackageContext(ctx context.Context, fileOrPkg string, goBinary string) error {
+	return PrecompileBuildPackageWithOptions(ctx, fileOrPkg, PrecompileOptions{GoBinary: goBinary})
+}
+
+// PrecompileBuildPackageWithOptions is like PrecompileBuildPackageContext,
+// with opts.GoBinary, opts.BuildEnv and opts.Offline, and run from
+// opts.RootDir if set, rather than from the guessed module root.
+func PrecompileBuildPackageWithOptions(ctx context.Context, fileOrPkg string, opts PrecompileOptions) error {
 	// TODO: use cmd/compile instead of exec?
-	// TODO: find the nearest go.mod file, chdir in the same folder, rim prefix?
 	// TODO: temporarily create an in-memory go.mod or disable go modules for gno?
-	// TODO: ignore .go files that were not generated from gno?
 	// TODO: automatically precompile if not yet done.
 
-	files := []string{}
-
+	goBinary, err := LookGoBinary(opts.GoBinary)
+	if err != nil {
+		return err
+	}
 	info, err := os.Stat(fileOrPkg)
 	if err != nil {
 		return fmt.Errorf("invalid file or package path: %w", err)
 	}
+	pkgDir, err := filepath.Abs(fileOrPkg)
+	if err != nil {
+		return fmt.Errorf("invalid file or package path: %w", err)
+	}
 	if !info.IsDir() {
-		file := fileOrPkg
-		files = append(files, file)
-	} else {
-		pkgDir := fileOrPkg
-		goGlob := filepath.Join(pkgDir, "*.go")
-		goMatches, err := filepath.Glob(goGlob)
-		if err != nil {
-			return fmt.Errorf("glob: %w", err)
-		}
-		for _, goMatch := range goMatches {
-			switch {
-			case strings.HasPrefix(goMatch, "."): // skip
-			case strings.HasSuffix(goMatch, "_filetest.go"): // skip
-			case strings.HasSuffix(goMatch, "_filetest.gno.gen.go"): // skip
-			case strings.HasSuffix(goMatch, "_test.go"): // skip
-			case strings.HasSuffix(goMatch, "_test.gno.gen.go"): // skip
-			default:
-				files = append(files, goMatch)
-			}
-		}
+		pkgDir = filepath.Dir(pkgDir)
+	}
+	if err := verifyGnoBuildTags(pkgDir); err != nil {
+		return err
+	}
+	if err := verifySinglePackage(pkgDir); err != nil {
+		return err
 	}
 
-	sort.Strings(files)
-	args := append([]string{"build", "-v", "-tags=gno"}, files...)
-	cmd := exec.Command(goBinary, args...)
-	rootDir, err := guessRootDir(fileOrPkg, goBinary)
-	if err == nil {
+	args := []string{"build", "-v", "-tags=gno", pkgDir}
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	// build from the module root if possible, so that the gno imports are
+	// resolved; otherwise, from the package directory.
+	cmd.Dir = pkgDir
+	if opts.RootDir != "" {
+		cmd.Dir = opts.RootDir
+	} else if rootDir, err := guessRootDir(ctx, pkgDir, goBinary, opts); err == nil {
 		cmd.Dir = rootDir
 	}
+	cmd.Env = opts.buildEnv()
 	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, string(out))
-		return fmt.Errorf("std go compiler: %w", err)
+		if offlineErr := offlineError(out); opts.Offline && offlineErr != nil {
+			return offlineErr
+		}
+		return &BuildError{Err: err, Output: string(out), Diagnostics: parseBuildDiagnostics(string(out), cmd.Dir)}
 	}
 
 	return nil
 }
 
-func precompileAST(fset *token.FileSet, f *ast.File, checkWhitelist bool) (ast.Node, error) {
+// verifyGnoBuildTags returns an error for each generated non-test file of
+// pkgDir that wouldn't be built with -tags=gno, or that would be built
+// without it: in both cases, the package would be checked without some of
+// its code, or with code that is not meant for gno, and silently pass.
+func verifyGnoBuildTags(pkgDir string) error {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*.go"))
+	if err != nil {
+		return fmt.Errorf("glob: %w", err)
+	}
+
+	gnoCtxt, goCtxt := build.Default, build.Default
+	gnoCtxt.BuildTags = []string{"gno"}
 	var errs error
+	for _, file := range files {
+		name := filepath.Base(file)
+		if strings.HasSuffix(name, "_test.go") || strings.HasPrefix(name, ".") {
+			continue // test files, and filetests, which are hidden.
+		}
+		generated, err := IsGeneratedFile(file)
+		if err != nil {
+			return err
+		}
+		if !generated && !strings.HasSuffix(name, ".gno.gen.go") {
+			continue // hand-written files are built as they are.
+		}
+
+		withGno, err := gnoCtxt.MatchFile(pkgDir, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		withoutGno, err := goCtxt.MatchFile(pkgDir, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		switch {
+		case !withGno:
+			errs = multierr.Append(errs, fmt.Errorf("%s: excluded from the build by its build constraints", file))
+		case withoutGno:
+			errs = multierr.Append(errs, fmt.Errorf("%s: missing the gno build constraint", file))
+		}
+	}
+	return errs
+}
+
+// goBuildFiles returns the names of the non-test .go files of pkgDir that go
+// build compiles with -tags=gno, as the go toolchain selects them: by their
+// build constraints and their _GOOS and _GOARCH suffixes, but the hidden
+// files and the ones starting with "_".
+func goBuildFiles(pkgDir string) ([]string, error) {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxt := build.Default
+	ctxt.BuildTags = []string{"gno"}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		match, err := ctxt.MatchFile(pkgDir, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(pkgDir, name), err)
+		}
+		if match {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// verifySinglePackage returns an error naming the packages and their files
+// if the files of pkgDir built with -tags=gno declare different packages:
+// the go toolchain only reports the first two conflicting files.
+func verifySinglePackage(pkgDir string) error {
+	names, err := goBuildFiles(pkgDir)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	var pkgNames []string
+	pkgFiles := map[string][]string{}
+	for _, name := range names {
+		file := filepath.Join(pkgDir, name)
+		f, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue // reported by the build.
+		}
+		pkgName := f.Name.Name
+		if _, ok := pkgFiles[pkgName]; !ok {
+			pkgNames = append(pkgNames, pkgName)
+		}
+		pkgFiles[pkgName] = append(pkgFiles[pkgName], name)
+	}
+	if len(pkgNames) < 2 {
+		return nil
+	}
+
+	pkgs := make([]string, len(pkgNames))
+	for i, pkgName := range pkgNames {
+		pkgs[i] = fmt.Sprintf("%s (%s)", pkgName, strings.Join(pkgFiles[pkgName], ", "))
+	}
+	return fmt.Errorf("multiple packages in %s: %s", pkgDir, strings.Join(pkgs, ", "))
+}
+
+// UnsupportedConstruct is a construct accepted by the go toolchain, but not
+// by gno, so that its translation would behave differently.
+type UnsupportedConstruct struct {
+	// Name is the plural name of the construct, used in diagnostics.
+	Name string
+	// Match reports whether node is an occurrence of the construct; imports
+	// maps the names of the imports of its file to their gno paths.
+	Match func(node ast.Node, imports map[string]string) bool
+}
+
+// UnsupportedConstructs is the registry of the constructs reported by
+// Precompile. It can be extended to report more constructs.
+var UnsupportedConstructs = []UnsupportedConstruct{
+	{
+		Name: "goroutines",
+		Match: func(node ast.Node, _ map[string]string) bool {
+			_, ok := node.(*ast.GoStmt)
+			return ok
+		},
+	},
+	{
+		Name: "select statements",
+		Match: func(node ast.Node, _ map[string]string) bool {
+			_, ok := node.(*ast.SelectStmt)
+			return ok
+		},
+	},
+	{
+		Name: "channel send statements",
+		Match: func(node ast.Node, _ map[string]string) bool {
+			_, ok := node.(*ast.SendStmt)
+			return ok
+		},
+	},
+	{
+		Name: "type parameters",
+		Match: func(node ast.Node, _ map[string]string) bool {
+			switch n := node.(type) {
+			case *ast.FuncType:
+				return n.TypeParams != nil
+			case *ast.TypeSpec:
+				return n.TypeParams != nil
+			}
+			return false
+		},
+	},
+	{
+		// the stdshim has no events: they need the realm context.
+		Name: "std.Emit calls",
+		Match: func(node ast.Node, imports map[string]string) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return false
+			}
+			pkgPath, name, ok := importedSelector(call.Fun, imports)
+			return ok && pkgPath == gnoStdPkgBefore && name == "Emit"
+		},
+	},
+	{
+		// the realm types are translated to plain go types, which don't
+		// carry the realm they belong to.
+		Name: "type assertions to realm types",
+		Match: func(node ast.Node, imports map[string]string) bool {
+			assert, ok := node.(*ast.TypeAssertExpr)
+			if !ok || assert.Type == nil {
+				return false
+			}
+			typ := assert.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			pkgPath, _, ok := importedSelector(typ, imports)
+			return ok && strings.HasPrefix(pkgPath, "gno.land/r/")
+		},
+	},
+}
+
+// importedSelector returns the gno path of the package of expr and the
+// selected name, if expr selects a name of one of the imports.
+func importedSelector(expr ast.Expr, imports map[string]string) (pkgPath, name string, ok bool) {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	// local identifiers shadowing the import are resolved by the parser.
+	if !ok || x.Obj != nil {
+		return "", "", false
+	}
+	pkgPath, ok = imports[x.Name]
+	return pkgPath, sel.Sel.Name, ok
+}
+
+// importedPkgs maps the names of the imports of f to their paths. The names
+// of the imports not named explicitly are the last elements of their paths,
+// as the gno packages are named.
+func importedPkgs(f *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, importSpec := range f.Imports {
+		importPath, err := strconv.Unquote(importSpec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if importSpec.Name != nil {
+			name = importSpec.Name.Name
+		}
+		if name != "_" && name != "." {
+			imports[name] = importPath
+		}
+	}
+	return imports
+}
+
+func precompileAST(fset *token.FileSet, f *ast.File, checkWhitelist bool, opts PrecompileOptions) (ast.Node, []Diagnostic, error) {
+	var (
+		errs  error
+		diags []Diagnostic
+	)
 
+	rules := opts.rewriteRules()
 	imports := astutil.Imports(fset, f)
+	// the gno paths of the imports, before they are rewritten.
+	importedPaths := importedPkgs(f)
+
+	// the names of the imports are the ones of the gno packages, which the
+	// rewritten paths don't tell. Only the known names are listed.
+	importNames := map[*ast.ImportSpec]string{}
+	for _, importSpec := range f.Imports {
+		importPath, err := strconv.Unquote(importSpec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if name, ok := importName(importSpec, importPath); ok {
+			importNames[importSpec] = name
+		}
+	}
 
 	// import whitelist
-	if checkWhitelist {
+	if checkWhitelist && opts.SkipWhitelist {
+		diags = append(diags, Diagnostic{
+			Pos:      fset.Position(f.Name.Pos()),
+			Msg:      "import whitelist check skipped (SkipWhitelist is set)",
+			Severity: SeverityWarning,
+		})
+	}
+	whitelistMode := opts.WhitelistMode
+	if checkWhitelist && !opts.SkipWhitelist && whitelistMode != WhitelistOff {
 		for _, paragraph := range imports {
 			for _, importSpec := range paragraph {
-				importPath := strings.TrimPrefix(strings.TrimSuffix(importSpec.Path.Value, `"`), `"`)
-
-				if strings.HasPrefix(importPath, gnoRealmPkgsPrefixBefore) {
-					continue
+				importPath, err := strconv.Unquote(importSpec.Path.Value)
+				if err != nil {
+					continue // reported below.
 				}
 
-				if strings.HasPrefix(importPath, gnoPackagePrefixBefore) {
+				if rule, ok := rules.find(importPath); ok && rule.isPrefix() {
 					continue
 				}
 
@@ -292,56 +2224,348 @@ func precompileAST(fset *token.FileSet, f *ast.File, checkWhitelist bool) (ast.N
 					continue
 				}
 
-				errs = multierr.Append(errs, fmt.Errorf("import %q is not in the whitelist", importPath))
+				notWhitelisted := &ImportNotWhitelistedError{
+					ImportPath: importPath,
+					Position:   fset.Position(importSpec.Pos()),
+					Suggestion: suggestWhitelistedImport(importPath),
+				}
+				if whitelistMode == WhitelistWarn {
+					diags = append(diags, Diagnostic{
+						Pos:      notWhitelisted.Position,
+						Msg:      notWhitelisted.Error() + " (allowed in warn mode)",
+						Severity: SeverityWarning,
+					})
+					continue
+				}
+				diags = append(diags, Diagnostic{
+					Pos:      notWhitelisted.Position,
+					Msg:      notWhitelisted.Error(),
+					Severity: SeverityError,
+				})
+				errs = multierr.Append(errs, notWhitelisted)
 			}
 		}
 	}
 
-	// rewrite imports
+	// rewrite imports; RewriteImport only changes the paths, so that the
+	// local names of the imports, if any, are kept.
 	for _, paragraph := range imports {
 		for _, importSpec := range paragraph {
-			importPath := strings.TrimPrefix(strings.TrimSuffix(importSpec.Path.Value, `"`), `"`)
-
-			// std package
-			if importPath == gnoStdPkgBefore {
-				if !astutil.RewriteImport(fset, f, gnoStdPkgBefore, gnoStdPkgAfter) {
-					errs = multierr.Append(errs, fmt.Errorf("failed to replace the %q package with %q", gnoStdPkgBefore, gnoStdPkgAfter))
-				}
+			importPath, err := strconv.Unquote(importSpec.Path.Value)
+			if err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%s: invalid import path %s: %w", fset.Position(importSpec.Pos()), importSpec.Path.Value, err))
+				continue
 			}
 
-			// p/pkg packages
-			if strings.HasPrefix(importPath, gnoPackagePrefixBefore) {
-				target := gnoPackagePrefixAfter + strings.TrimPrefix(importPath, gnoPackagePrefixBefore)
-
-				if !astutil.RewriteImport(fset, f, importPath, target) {
-					errs = multierr.Append(errs, fmt.Errorf("failed to replace the %q package with %q", importPath, target))
-				}
+			rule, ok := rules.find(importPath)
+			if !ok {
+				continue
 			}
+			target := rule.rewrite(importPath)
+			if !astutil.RewriteImport(fset, f, importPath, target) {
+				errs = multierr.Append(errs, fmt.Errorf("failed to replace the %q package with %q", importPath, target))
+			}
+		}
+	}
 
-			// r/realm packages
-			if strings.HasPrefix(importPath, gnoRealmPkgsPrefixBefore) {
-				target := gnoRealmPkgsPrefixAfter + strings.TrimPrefix(importPath, gnoRealmPkgsPrefixBefore)
-
-				if !astutil.RewriteImport(fset, f, importPath, target) {
-					errs = multierr.Append(errs, fmt.Errorf("failed to replace the %q package with %q", importPath, target))
-				}
+	// the std selectors are checked, if std is imported and rewritten to
+	// stdshim.
+	stdName := ""
+	if rule, ok := rules.find(gnoStdPkgBefore); ok && rule.rewrite(gnoStdPkgBefore) == gnoStdPkgAfter {
+		for _, importSpec := range f.Imports {
+			if path, _ := strconv.Unquote(importSpec.Path.Value); path != gnoStdPkgAfter {
+				continue
+			}
+			stdName = "std"
+			if importSpec.Name != nil {
+				stdName = importSpec.Name.Name
 			}
 		}
 	}
+	stdSeverity := SeverityError
+	if !checkWhitelist {
+		// test files may use the std natives only defined by the gno tests.
+		stdSeverity = SeverityWarning
+	}
+
+	// the print builtins are rewritten to the functions of fmt, with the
+	// name it is imported with, or else is imported once they are.
+	fmtName, fmtImported := "", false
+	printRewritten := false
+	if opts.RewriteBuiltinPrint {
+		fmtName, fmtImported = fmtImportName(f)
+	}
+
+	// the nodes of the unsupported constructs, which are not checked
+	// further once reported.
+	unsupported := map[ast.Node]bool{}
 
 	// custom handler
 	node := astutil.Apply(f,
 		// pre
 		func(c *astutil.Cursor) bool {
-			// do things here
+			for _, construct := range UnsupportedConstructs {
+				if !construct.Match(c.Node(), importedPaths) {
+					continue
+				}
+				diag := Diagnostic{
+					Pos:      fset.Position(c.Node().Pos()),
+					Msg:      construct.Name + " are not supported",
+					Severity: SeverityError,
+				}
+				unsupported[c.Node()] = true
+				diags = append(diags, diag)
+				errs = multierr.Append(errs, fmt.Errorf("%s: %s", diag.Pos, diag.Msg))
+			}
 			return true
 		},
 		// post
 		func(c *astutil.Cursor) bool {
-			// and here
+			if call, ok := c.Node().(*ast.CallExpr); ok && opts.RewriteBuiltinPrint {
+				// the builtins are not resolved by the parser.
+				fun, ok := call.Fun.(*ast.Ident)
+				if ok && fun.Obj == nil && builtinPrintRewrites[fun.Name] != "" {
+					call.Fun = &ast.SelectorExpr{
+						X:   &ast.Ident{NamePos: fun.Pos(), Name: fmtName},
+						Sel: ast.NewIdent(builtinPrintRewrites[fun.Name]),
+					}
+					printRewritten = true
+				}
+				return true
+			}
+			sel, ok := c.Node().(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			x, ok := sel.X.(*ast.Ident)
+			// local identifiers shadowing the import are resolved by the parser.
+			if !ok || x.Name != stdName || x.Obj != nil || unsupported[c.Parent()] {
+				return true
+			}
+			if renamed, ok := StdShimRenames[sel.Sel.Name]; ok {
+				sel.Sel.Name = renamed
+				return true
+			}
+			if isStdShimSymbol(sel.Sel.Name) {
+				return true
+			}
+			diag := Diagnostic{
+				Pos:      fset.Position(sel.Pos()),
+				Msg:      fmt.Sprintf("%s.%s has no equivalent in %s", gnoStdPkgBefore, sel.Sel.Name, gnoStdPkgAfter),
+				Severity: stdSeverity,
+			}
+			diags = append(diags, diag)
+			if diag.Severity == SeverityError {
+				errs = multierr.Append(errs, fmt.Errorf("%s: %s", diag.Pos, diag.Msg))
+			}
 			return true
 		},
 	)
+	if printRewritten && !fmtImported {
+		name := fmtName
+		if name == "fmt" {
+			name = ""
+		}
+		astutil.AddNamedImport(fset, f, name, "fmt")
+	}
+	for _, t := range opts.Transforms {
+		node = astutil.Apply(node, t.Pre, t.Post)
+	}
+
+	switch {
+	case opts.FixImports:
+		if err := fixImports(fset, f, importNames); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("fix imports: %w", err))
+		}
+	case opts.PruneUnusedImports:
+		pruneUnusedImports(fset, f, importNames)
+	}
+
+	// the order of the init functions, and of the initialization of the
+	// package-level variables, depends on the order of the declarations.
+	sortDeclsBySource(f)
 
-	return node, errs
+	return node, diags, errs
+}
+
+// builtinPrintRewrites are the functions of fmt replacing the print
+// builtins, with PrecompileOptions.RewriteBuiltinPrint.
+var builtinPrintRewrites = map[string]string{
+	"println": "Println",
+	"print":   "Print",
+}
+
+// fmtImportName returns the name fmt is imported with in f, if it is. It
+// returns otherwise the name to import it with: "fmt", unless an identifier
+// of f is already named so.
+func fmtImportName(f *ast.File) (name string, imported bool) {
+	for _, importSpec := range f.Imports {
+		if importPath, _ := strconv.Unquote(importSpec.Path.Value); importPath != "fmt" {
+			continue
+		}
+		if importSpec.Name == nil {
+			return "fmt", true
+		}
+		if name := importSpec.Name.Name; name != "_" && name != "." {
+			return name, true
+		}
+	}
+
+	idents := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			idents[ident.Name] = true
+		}
+		return true
+	})
+	name = "fmt"
+	for i := 1; idents[name]; i++ {
+		name = "fmt" + strconv.Itoa(i)
+	}
+	return name, false
+}
+
+// sortDeclsBySource sorts the declarations of f that have a position in the
+// order of the source, should a transformation have moved them, and leaves
+// the declarations it added, without a position, in place.
+func sortDeclsBySource(f *ast.File) {
+	var indexes []int
+	var decls []ast.Decl
+	for i, decl := range f.Decls {
+		if decl.Pos().IsValid() {
+			indexes = append(indexes, i)
+			decls = append(decls, decl)
+		}
+	}
+	sort.SliceStable(decls, func(i, j int) bool {
+		return decls[i].Pos() < decls[j].Pos()
+	})
+	for i, index := range indexes {
+		f.Decls[index] = decls[i]
+	}
+}
+
+// importName returns the name of the package imported by importSpec at
+// importPath, and whether it is known: it is the local name of the import, if
+// any, or the last element of the path of a standard library package. The
+// other packages may be named differently from their directory, e.g.
+// gno.land/p/demo/avl/v2, and their name is unknown.
+func importName(importSpec *ast.ImportSpec, importPath string) (string, bool) {
+	if importSpec.Name != nil {
+		return importSpec.Name.Name, true
+	}
+	if first, _, _ := strings.Cut(importPath, "/"); strings.Contains(first, ".") {
+		return "", false
+	}
+	return path.Base(importPath), true
+}
+
+// fixImports adds the missing imports of f and deletes its unused ones, as
+// goimports does.
+func fixImports(fset *token.FileSet, f *ast.File, importNames map[*ast.ImportSpec]string) error {
+	// goimports guesses the names of the packages it can't load, such as
+	// the stdshim, from their path: the gno names are made explicit while
+	// it runs, if the rewriting changed them.
+	var named []*ast.ImportSpec
+	for _, importSpec := range f.Imports {
+		importPath, err := strconv.Unquote(importSpec.Path.Value)
+		name, ok := importNames[importSpec]
+		if err != nil || !ok || importSpec.Name != nil || name == path.Base(importPath) {
+			continue
+		}
+		importSpec.Name = ast.NewIdent(name)
+		named = append(named, importSpec)
+	}
+	var buf bytes.Buffer
+	err := format.Node(&buf, fset, f)
+	for _, importSpec := range named {
+		importSpec.Name = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	filename := fset.Position(f.Package).Filename
+	fixed, err := imports.Process(filename, buf.Bytes(), &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+	if err != nil {
+		return err
+	}
+	fixedFile, err := parser.ParseFile(token.NewFileSet(), filename, fixed, parser.ImportsOnly)
+	if err != nil {
+		return err
+	}
+
+	// the changes are applied to f, so that it still matches the
+	// translation.
+	fixedNames := map[string]string{}
+	for _, importSpec := range fixedFile.Imports {
+		importPath, _ := strconv.Unquote(importSpec.Path.Value)
+		fixedNames[importPath] = ""
+		if importSpec.Name != nil {
+			fixedNames[importPath] = importSpec.Name.Name
+		}
+	}
+	current := map[string]bool{}
+	for _, importSpec := range append([]*ast.ImportSpec{}, f.Imports...) {
+		importPath, _ := strconv.Unquote(importSpec.Path.Value)
+		current[importPath] = true
+		if _, ok := fixedNames[importPath]; ok {
+			continue
+		}
+		localName := ""
+		if importSpec.Name != nil {
+			localName = importSpec.Name.Name
+		}
+		astutil.DeleteNamedImport(fset, f, localName, importPath)
+	}
+	for _, importSpec := range fixedFile.Imports {
+		importPath, _ := strconv.Unquote(importSpec.Path.Value)
+		if !current[importPath] {
+			astutil.AddNamedImport(fset, f, fixedNames[importPath], importPath)
+		}
+	}
+	return nil
+}
+
+// pruneUnusedImports deletes the imports of f that are not referred to, which
+// go build would reject while gno doesn't, or which the transformations made
+// unused. importNames are the names of the imports, which the blank and dot
+// imports don't have to be referred to by.
+func pruneUnusedImports(fset *token.FileSet, f *ast.File, importNames map[*ast.ImportSpec]string) {
+	// the references to the imports are the selectors of identifiers the
+	// parser didn't resolve to a local declaration.
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+
+	for _, importSpec := range append([]*ast.ImportSpec{}, f.Imports...) {
+		name, ok := importNames[importSpec]
+		if !ok || name == "_" || name == "." || used[name] {
+			continue
+		}
+		importPath, err := strconv.Unquote(importSpec.Path.Value)
+		if err != nil {
+			continue
+		}
+		localName := ""
+		if importSpec.Name != nil {
+			localName = importSpec.Name.Name
+		}
+		astutil.DeleteNamedImport(fset, f, localName, importPath)
+	}
+}
+
+func isStdShimSymbol(name string) bool {
+	for _, symbol := range stdShimSymbols {
+		if name == symbol {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,151 @@
+package gnolang
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gnolang/gno/pkgs/std"
+)
+
+// ImportCycleError is returned by CheckImportCycles for a cycle in the
+// imports of the translated packages.
+type ImportCycleError struct {
+	// Cycle is the gno paths of the packages of the cycle, each importing
+	// the next one, and the last one the first. The last one is the first
+	// one again, unless the rewriting maps them to the same go path.
+	Cycle []string
+	// Collisions maps the go paths of the cycle to which several gno paths
+	// are rewritten, to these gno paths, sorted.
+	Collisions map[string][]string
+}
+
+func (e *ImportCycleError) Error() string {
+	msg := "import cycle once rewritten: " + strings.Join(e.Cycle, " -> ")
+	goPaths := make([]string, 0, len(e.Collisions))
+	for goPath := range e.Collisions {
+		goPaths = append(goPaths, goPath)
+	}
+	sort.Strings(goPaths)
+	for _, goPath := range goPaths {
+		msg += fmt.Sprintf(" (%s are all rewritten to %s)", strings.Join(e.Collisions[goPath], ", "), goPath)
+	}
+	return msg
+}
+
+// CheckImportCycles returns an *ImportCycleError if the imports of the .gno
+// files of mempkgs are cyclic once rewritten with rules. The rewriting can
+// introduce cycles when it maps several gno paths to the same go path, which
+// go build would reject with an error mentioning only the go paths. The
+// filetests are skipped, as they import their own package.
+func CheckImportCycles(mempkgs []*std.MemPackage, rules RewriteRules) error {
+	// the graph is the one of the go paths, whose edges are labelled with
+	// the gno path of the import.
+	type edge struct {
+		gnoPath string
+		to      string
+	}
+	edges := map[string][]edge{}
+	pkgPaths := map[string]string{}
+	gnoPaths := map[string]map[string]bool{}
+	addGnoPath := func(goPath, gnoPath string) {
+		if gnoPaths[goPath] == nil {
+			gnoPaths[goPath] = map[string]bool{}
+		}
+		gnoPaths[goPath][gnoPath] = true
+	}
+
+	var goPaths []string
+	for _, mempkg := range mempkgs {
+		goPath := rules.Rewrite(mempkg.Path)
+		if _, ok := pkgPaths[goPath]; !ok {
+			pkgPaths[goPath] = mempkg.Path
+			goPaths = append(goPaths, goPath)
+		}
+		addGnoPath(goPath, mempkg.Path)
+
+		seen := map[string]bool{}
+		for _, mfile := range mempkg.Files {
+			if !strings.HasSuffix(mfile.Name, ".gno") || strings.HasSuffix(mfile.Name, "_filetest.gno") {
+				continue
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), mfile.Name, mfile.Body, parser.ImportsOnly)
+			if err != nil {
+				return fmt.Errorf("%s: parse: %w", mfile.Name, err)
+			}
+			for _, spec := range f.Imports {
+				gnoPath, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					return fmt.Errorf("%s: invalid import path %s: %w", mfile.Name, spec.Path.Value, err)
+				}
+				if seen[gnoPath] {
+					continue
+				}
+				seen[gnoPath] = true
+				to := rules.Rewrite(gnoPath)
+				edges[goPath] = append(edges[goPath], edge{gnoPath: gnoPath, to: to})
+				addGnoPath(to, gnoPath)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := map[string]int{}
+	var stack []edge
+	var visit func(goPath string) *ImportCycleError
+	visit = func(goPath string) *ImportCycleError {
+		switch states[goPath] {
+		case visited:
+			return nil
+		case visiting:
+			// the cycle starts where goPath was first entered, and ends
+			// with its import at the top of the stack.
+			start := 0
+			for stack[start].to != goPath {
+				start++
+			}
+			cycleErr := &ImportCycleError{Collisions: map[string][]string{}}
+			for _, e := range stack[start:] {
+				cycleErr.Cycle = append(cycleErr.Cycle, e.gnoPath)
+			}
+			for _, e := range stack[start:] {
+				if len(gnoPaths[e.to]) < 2 {
+					continue
+				}
+				var paths []string
+				for path := range gnoPaths[e.to] {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				cycleErr.Collisions[e.to] = paths
+			}
+			return cycleErr
+		}
+
+		states[goPath] = visiting
+		for _, e := range edges[goPath] {
+			stack = append(stack, e)
+			if err := visit(e.to); err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+		}
+		states[goPath] = visited
+		return nil
+	}
+
+	for _, goPath := range goPaths {
+		// the root of the stack is the package itself.
+		stack = []edge{{gnoPath: pkgPaths[goPath], to: goPath}}
+		if err := visit(goPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
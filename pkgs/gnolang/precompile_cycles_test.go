@@ -0,0 +1,65 @@
+package gnolang
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckImportCycles(t *testing.T) {
+	mempkg := func(path string, imports ...string) *std.MemPackage {
+		body := "package foo\n"
+		for _, imported := range imports {
+			body += "import _ \"" + imported + "\"\n"
+		}
+		return &std.MemPackage{
+			Name: "foo",
+			Path: path,
+			Files: []*std.MemFile{
+				{Name: "foo.gno", Body: body},
+				{Name: "foo_filetest.gno", Body: "package main\nimport _ \"" + path + "\"\n"},
+			},
+		}
+	}
+
+	// a diamond is not a cycle.
+	err := CheckImportCycles([]*std.MemPackage{
+		mempkg("gno.land/r/a", "gno.land/p/demo/b", "gno.land/p/demo/c"),
+		mempkg("gno.land/p/demo/b", "gno.land/p/demo/d"),
+		mempkg("gno.land/p/demo/c", "gno.land/p/demo/d"),
+		mempkg("gno.land/p/demo/d", "strings"),
+	}, DefaultRewriteRules)
+	assert.NoError(t, err)
+
+	err = CheckImportCycles([]*std.MemPackage{
+		mempkg("gno.land/r/a", "gno.land/p/demo/b"),
+		mempkg("gno.land/p/demo/b", "gno.land/r/a"),
+	}, DefaultRewriteRules)
+	assert.EqualError(t, err, "import cycle once rewritten: gno.land/r/a -> gno.land/p/demo/b -> gno.land/r/a")
+
+	// the realms and the packages are rewritten to the same go paths, so
+	// that the realm imports itself.
+	rules := RewriteRules{
+		{Before: "gno.land/r/demo/", After: "example.com/demo/"},
+		{Before: "gno.land/p/demo/", After: "example.com/demo/"},
+	}
+	err = CheckImportCycles([]*std.MemPackage{
+		mempkg("gno.land/r/demo/foo", "gno.land/p/demo/foo"),
+	}, rules)
+	assert.EqualError(t, err, "import cycle once rewritten: gno.land/r/demo/foo -> gno.land/p/demo/foo "+
+		"(gno.land/p/demo/foo, gno.land/r/demo/foo are all rewritten to example.com/demo/foo)")
+	var cycleErr *ImportCycleError
+	if assert.True(t, errors.As(err, &cycleErr)) {
+		assert.Equal(t, []string{"gno.land/r/demo/foo", "gno.land/p/demo/foo"}, cycleErr.Cycle)
+	}
+
+	// the cycle is reported before building.
+	_, err = PrecompileMemPkg(mempkg("gno.land/r/demo/foo", "gno.land/p/demo/foo"), PrecompileOptions{
+		RewriteRules: rules,
+		Gobuild:      true,
+		GoBinary:     "/nonexistent/go",
+	})
+	assert.ErrorAs(t, err, &cycleErr)
+}
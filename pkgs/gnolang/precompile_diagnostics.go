@@ -0,0 +1,128 @@
+package gnolang
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BuildError is returned by PrecompileBuildPackage when the go toolchain
+// fails to build the package.
+type BuildError struct {
+	// Err is the error of the go toolchain, usually an *exec.ExitError.
+	Err error
+	// Output is the combined output of the go toolchain.
+	Output string
+	// Diagnostics are the errors of Output located in the generated files,
+	// in the order of Output. They point to the .gno sources of the files
+	// when these are found next to them; the columns are still the ones of
+	// the generated files.
+	Diagnostics []Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("std go compiler: %s\n%s", e.Err, e.Output)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// buildDiagnosticRegexp matches the "file:line:col: message" lines printed
+// by the go toolchain, the column being optional.
+var buildDiagnosticRegexp = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// parseBuildDiagnostics returns the diagnostics of out, the output of the go
+// toolchain run in dir, mapped to the .gno sources of the generated files.
+// The indented lines following a diagnostic, such as the "have" and "want"
+// of a mismatched call, are appended to its message.
+func parseBuildDiagnostics(out string, dir string) []Diagnostic {
+	var diags []Diagnostic
+	sourceMaps := map[string]*generatedSource{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "\t") && len(diags) > 0 {
+			diags[len(diags)-1].Msg += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		match := buildDiagnosticRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		path := match[1]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		lineNum, _ := strconv.Atoi(match[2])
+		col, _ := strconv.Atoi(match[3])
+		pos := token.Position{Filename: path, Line: lineNum, Column: col}
+
+		src, ok := sourceMaps[path]
+		if !ok {
+			src = findGeneratedSource(path)
+			sourceMaps[path] = src
+		}
+		if src != nil {
+			if srcLine := src.sourceMap.SourceLine(lineNum); srcLine > 0 {
+				pos.Filename, pos.Line = src.path, srcLine
+			}
+		}
+		diags = append(diags, Diagnostic{Pos: pos, Msg: match[4], Severity: SeverityError})
+	}
+	return diags
+}
+
+// generatedSource is the .gno source of a generated file.
+type generatedSource struct {
+	path      string
+	sourceMap SourceMap
+}
+
+// findGeneratedSource returns the .gno source of the generated file at
+// goPath, found next to it by its name, or nil if it has none. The source
+// map is computed against the generated file, so that it holds whatever the
+// options it was generated with.
+func findGeneratedSource(goPath string) *generatedSource {
+	generated, err := IsGeneratedFile(goPath)
+	if err != nil || !generated {
+		return nil
+	}
+	srcPaths, err := filepath.Glob(filepath.Join(filepath.Dir(goPath), "*.gno"))
+	if err != nil {
+		return nil
+	}
+	name := filepath.Base(goPath)
+	for _, srcPath := range srcPaths {
+		srcName := filepath.Base(srcPath)
+		if GeneratedOutputNaming(srcName) != name && PureOutputNaming(srcName) != name {
+			continue
+		}
+
+		src, err := os.ReadFile(srcPath)
+		if err != nil {
+			return nil
+		}
+		translated, err := os.ReadFile(goPath)
+		if err != nil {
+			return nil
+		}
+		// the translation is mapped to the generated file, which was
+		// written with the default options.
+		_, tags := GetPrecompileFilenameAndTags(srcPath)
+		opts := DefaultPrecompileOptions()
+		opts.WhitelistMode = WhitelistOff
+		res, err := PrecompileWithFset(token.NewFileSet(), string(src), tags, srcPath, opts)
+		if err != nil {
+			return nil
+		}
+		sm, err := buildSourceMap(res.Fset, res.AST, string(translated))
+		if err != nil {
+			return nil
+		}
+		return &generatedSource{path: srcPath, sourceMap: sm}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package gnolang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FileDiff describes a generated file that is not up to date with its .gno
+// source.
+type FileDiff struct {
+	SourcePath string
+	TargetPath string
+	// Missing is true if the generated file doesn't exist.
+	Missing bool
+	// Diff is the unified diff from the generated file on disk to the
+	// translation of the source.
+	Diff string
+}
+
+// PrecompileDiff translates the .gno files of the package in pkgDir in
+// memory, and compares the translations with the generated files next to
+// them. It returns the generated files that are missing or stale, so that
+// callers committing them can check that they are up to date; the
+// differences are not errors.
+//
+// The translations must be reproducible: a HeaderTemplate using the
+// timestamp makes all the files differ.
+func PrecompileDiff(pkgDir string, opts PrecompileOptions) ([]FileDiff, error) {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*.gno"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	var diffs []FileDiff
+	for _, srcPath := range files {
+		src, err := os.ReadFile(srcPath)
+		if err != nil {
+			return nil, err
+		}
+		var translated bytes.Buffer
+		if _, err := PrecompileFileToWriter(src, srcPath, &translated, opts); err != nil {
+			return nil, fmt.Errorf("%s: %w", srcPath, err)
+		}
+
+		targetFilename := opts.OutputNaming.targetFilename(srcPath)
+		targetPath := filepath.Join(pkgDir, targetFilename)
+		generated, err := os.ReadFile(targetPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			diffs = append(diffs, FileDiff{SourcePath: srcPath, TargetPath: targetPath, Missing: true})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(generated, translated.Bytes()) {
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(generated)),
+			B:        difflib.SplitLines(translated.String()),
+			FromFile: targetPath,
+			ToFile:   targetPath + " (regenerated)",
+			Context:  3,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("diff %s: %w", targetPath, err)
+		}
+		diffs = append(diffs, FileDiff{SourcePath: srcPath, TargetPath: targetPath, Diff: diff})
+	}
+	return diffs, nil
+}
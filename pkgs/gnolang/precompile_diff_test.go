@@ -0,0 +1,50 @@
+package gnolang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecompileDiff(t *testing.T) {
+	dir := t.TempDir()
+	for name, source := range map[string]string{
+		"a.gno":      "package foo\n\nfunc A() {}\n",
+		"b.gno":      "package foo\n\nfunc B() {}\n",
+		"c_test.gno": "package foo\n",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644)
+		require.NoError(t, err)
+		_, err = PrecompileFile(filepath.Join(dir, name), PrecompileOptions{})
+		require.NoError(t, err)
+	}
+
+	diffs, err := PrecompileDiff(dir, PrecompileOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	// b.gno changed since its file was generated, and the file of c_test.gno
+	// was removed.
+	err = os.WriteFile(filepath.Join(dir, "b.gno"), []byte("package foo\n\nfunc B() int { return 1 }\n"), 0o644)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, ".c_test.gno.gen_test.go"))
+	require.NoError(t, err)
+
+	diffs, err = PrecompileDiff(dir, PrecompileOptions{})
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+
+	assert.Equal(t, filepath.Join(dir, "b.gno"), diffs[0].SourcePath)
+	assert.Equal(t, filepath.Join(dir, "b.gno.gen.go"), diffs[0].TargetPath)
+	assert.False(t, diffs[0].Missing)
+	assert.Contains(t, diffs[0].Diff, "-func B() {}\n+func B() int { return 1 }\n")
+
+	assert.Equal(t, FileDiff{
+		SourcePath: filepath.Join(dir, "c_test.gno"),
+		TargetPath: filepath.Join(dir, ".c_test.gno.gen_test.go"),
+		Missing:    true,
+	}, diffs[1])
+}
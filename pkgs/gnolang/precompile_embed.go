@@ -0,0 +1,118 @@
+package gnolang
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const goEmbedDirective = "//go:embed"
+
+// EmbedPatterns returns the patterns of the //go:embed directives of f, in
+// order. Quoted patterns are unquoted, as the go toolchain does.
+func EmbedPatterns(f *ast.File) ([]string, error) {
+	var patterns []string
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, goEmbedDirective) {
+				continue
+			}
+			args := strings.TrimPrefix(c.Text, goEmbedDirective)
+			if args != "" && args[0] != ' ' && args[0] != '\t' {
+				continue
+			}
+			argPatterns, err := parseEmbedArgs(args)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s directive %q: %w", goEmbedDirective, c.Text, err)
+			}
+			patterns = append(patterns, argPatterns...)
+		}
+	}
+	return patterns, nil
+}
+
+func parseEmbedArgs(args string) ([]string, error) {
+	var patterns []string
+	for {
+		args = strings.TrimLeft(args, " \t")
+		if args == "" {
+			break
+		}
+		if args[0] != '"' && args[0] != '`' {
+			end := strings.IndexAny(args, " \t")
+			if end < 0 {
+				end = len(args)
+			}
+			patterns = append(patterns, args[:end])
+			args = args[end:]
+			continue
+		}
+		quoted, err := strconv.QuotedPrefix(args)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+		args = args[len(quoted):]
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no pattern")
+	}
+	return patterns, nil
+}
+
+// MatchEmbedPatterns returns the files matched by the //go:embed patterns,
+// among the given slash-separated paths relative to the package directory.
+// As for the go toolchain, a pattern naming a directory matches the files it
+// contains, but those starting with "." or "_", and each pattern must match
+// at least one file.
+func MatchEmbedPatterns(patterns []string, files []string) ([]string, error) {
+	var matched []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("pattern %s: %w", pattern, err)
+		}
+
+		found := false
+		for _, file := range files {
+			if !matchEmbedPattern(pattern, file) {
+				continue
+			}
+			found = true
+			if !seen[file] {
+				seen[file] = true
+				matched = append(matched, file)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pattern %s: no matching files found", pattern)
+		}
+	}
+	return matched, nil
+}
+
+func matchEmbedPattern(pattern, file string) bool {
+	if ok, _ := path.Match(pattern, file); ok {
+		return true
+	}
+	// a pattern matching a parent directory embeds the file, unless it is
+	// hidden below that directory.
+	for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+		if ok, _ := path.Match(pattern, dir); !ok {
+			continue
+		}
+		for _, elem := range strings.Split(strings.TrimPrefix(file, dir+"/"), "/") {
+			if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
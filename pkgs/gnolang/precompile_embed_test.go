@@ -0,0 +1,86 @@
+package gnolang
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedPatterns(t *testing.T) {
+	source := "package foo\n\n" +
+		"//go:embed hello.txt\nvar hello string\n\n" +
+		"//go:embed static/*.css \"with space.txt\"\t`raw.txt`\nvar assets string\n\n" +
+		"//go:embedded is not a directive\nvar other string\n"
+	f, err := parser.ParseFile(token.NewFileSet(), "foo.gno", source, parser.ParseComments)
+	require.NoError(t, err)
+	patterns, err := EmbedPatterns(f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello.txt", "static/*.css", "with space.txt", "raw.txt"}, patterns)
+
+	f, err = parser.ParseFile(token.NewFileSet(), "foo.gno", "package foo\n\n//go:embed \"unterminated\nvar x string\n", parser.ParseComments)
+	require.NoError(t, err)
+	_, err = EmbedPatterns(f)
+	assert.ErrorContains(t, err, `invalid //go:embed directive "//go:embed \"unterminated"`)
+}
+
+func TestMatchEmbedPatterns(t *testing.T) {
+	files := []string{"hello.txt", "static/a.css", "static/b.css", "static/.hidden.css", "static/img/c.png", "foo.gno"}
+
+	matched, err := MatchEmbedPatterns([]string{"hello.txt", "static/*.css", "hello.txt"}, files)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello.txt", "static/a.css", "static/b.css", "static/.hidden.css"}, matched)
+
+	// a directory doesn't embed its hidden files.
+	matched, err = MatchEmbedPatterns([]string{"static"}, files)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"static/a.css", "static/b.css", "static/img/c.png"}, matched)
+
+	_, err = MatchEmbedPatterns([]string{"missing.txt"}, files)
+	assert.EqualError(t, err, "pattern missing.txt: no matching files found")
+	_, err = MatchEmbedPatterns([]string{"["}, files)
+	assert.EqualError(t, err, "pattern [: syntax error in pattern")
+}
+
+func TestPrecompileMemPkgEmbed(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "foo.gno", Body: "package foo\n\n//go:embed hello.txt\nvar Hello string\n"},
+			{Name: "hello.txt", Body: "hello world\n"},
+		},
+	}
+	_, err := PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, RootDir: t.TempDir()})
+	assert.NoError(t, err)
+
+	// the packages on chain can't import embed.
+	onChain := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n\nimport _ \"embed\"\n"}},
+	}
+	assert.ErrorContains(t, PrecompileAndCheckMempkg(onChain), `import "embed" is not in the whitelist`)
+
+	mempkg.Files = mempkg.Files[:1]
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, RootDir: t.TempDir()})
+	assert.EqualError(t, err, "build package: embed: pattern hello.txt: no matching files found")
+}
+
+func TestPrecompileEmbedImport(t *testing.T) {
+	// the translation imports embed for the //go:embed directives, which
+	// the gno source can't import.
+	res, err := Precompile("package foo\n\n//go:embed hello.txt\nvar Hello string\n", "gno", "foo.gno")
+	require.NoError(t, err)
+	assert.Contains(t, res.Translated, `import _ "embed"`)
+
+	res, err = Precompile("package foo\n\nvar Hello string\n", "gno", "foo.gno")
+	require.NoError(t, err)
+	assert.NotContains(t, res.Translated, "embed")
+
+	_, err = Precompile("package foo\n\nimport _ \"embed\"\n\n//go:embed hello.txt\nvar Hello string\n", "gno", "foo.gno")
+	assert.EqualError(t, err, `import "embed" is not in the whitelist`)
+}
@@ -0,0 +1,123 @@
+package gnolang
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BuildMarkerFilename is the name of the file written by
+// PrecompileBuildPackageIncremental in the package directory after a
+// successful build.
+const BuildMarkerFilename = ".gno-build-marker.json"
+
+// buildMarker records a successful build of a package.
+type buildMarker struct {
+	// Time is the time at which the build started.
+	Time time.Time
+	// Sources maps the names of the .gno files of the package to the
+	// sha256 of their content.
+	Sources map[string]string
+}
+
+// PrecompileBuildPackageIncremental is like PrecompileBuildPackageContext for
+// the package in pkgDir, containing both the .gno sources and their
+// translations, but skips the build if nothing changed since the last
+// successful one: the .gno sources must be the same, each older than its
+// translation, and the translations older than the build. It reports
+// whether the build was skipped.
+func PrecompileBuildPackageIncremental(ctx context.Context, pkgDir string, goBinary string) (bool, error) {
+	sources, err := hashGnoSources(pkgDir)
+	if err != nil {
+		return false, err
+	}
+	upToDate, err := isBuildUpToDate(pkgDir, sources)
+	if err != nil {
+		return false, err
+	}
+	if upToDate {
+		return true, nil
+	}
+
+	marker := buildMarker{Time: time.Now(), Sources: sources}
+	if err := PrecompileBuildPackageContext(ctx, pkgDir, goBinary); err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return false, fmt.Errorf("marshal build marker: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(pkgDir, BuildMarkerFilename), data, 0o644); err != nil {
+		return false, fmt.Errorf("write build marker: %w", err)
+	}
+	return false, nil
+}
+
+// isBuildUpToDate reports whether the build marker of pkgDir is still valid
+// for the given sources.
+func isBuildUpToDate(pkgDir string, sources map[string]string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(pkgDir, BuildMarkerFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read build marker: %w", err)
+	}
+	var marker buildMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return false, nil // rebuild and overwrite the invalid marker.
+	}
+
+	if len(marker.Sources) != len(sources) {
+		return false, nil
+	}
+	for name, hash := range sources {
+		if marker.Sources[name] != hash {
+			return false, nil
+		}
+
+		srcInfo, err := os.Stat(filepath.Join(pkgDir, name))
+		if err != nil {
+			return false, err
+		}
+		targetFilename, _ := GetPrecompileFilenameAndTags(name)
+		targetInfo, err := os.Stat(filepath.Join(pkgDir, targetFilename))
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !srcInfo.ModTime().Before(targetInfo.ModTime()) || !targetInfo.ModTime().Before(marker.Time) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hashGnoSources returns the sha256 of the .gno files of pkgDir, by name.
+func hashGnoSources(pkgDir string) (map[string]string, error) {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*.gno"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	sources := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		sources[filepath.Base(file)] = hex.EncodeToString(sum[:])
+	}
+	return sources, nil
+}
@@ -0,0 +1,86 @@
+package gnolang
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompileBuildPackageIncremental(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	// the fake go binary logs the builds.
+	binDir := t.TempDir()
+	logPath := filepath.Join(binDir, "builds.log")
+	goBinary := filepath.Join(binDir, "go")
+	script := "#!/bin/sh\nif [ \"$1\" = build ]; then echo build >> " + logPath + "; exit 0; fi\nexit 1\n"
+	err := os.WriteFile(goBinary, []byte(script), 0o755)
+	assert.NoError(t, err)
+	builds := func() int {
+		data, _ := os.ReadFile(logPath)
+		return strings.Count(string(data), "build\n")
+	}
+
+	dir := t.TempDir()
+	precompile := func(name, source string) {
+		t.Helper()
+		err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644)
+		assert.NoError(t, err)
+		_, err = PrecompileFile(filepath.Join(dir, name), PrecompileOptions{})
+		assert.NoError(t, err)
+	}
+	setModTime := func(name string, modTime time.Time) {
+		t.Helper()
+		err := os.Chtimes(filepath.Join(dir, name), modTime, modTime)
+		assert.NoError(t, err)
+	}
+	// the sources are older than their translations, which are older than
+	// the builds.
+	start := time.Now().Add(-time.Hour)
+	precompile("a.gno", "package foo\n")
+	precompile("b.gno", "package foo\n")
+	for _, name := range []string{"a.gno", "b.gno"} {
+		setModTime(name, start)
+		targetFilename, _ := GetPrecompileFilenameAndTags(name)
+		setModTime(targetFilename, start.Add(time.Minute))
+	}
+	build := func() bool {
+		t.Helper()
+		skipped, err := PrecompileBuildPackageIncremental(context.Background(), dir, goBinary)
+		assert.NoError(t, err)
+		return skipped
+	}
+
+	assert.False(t, build())
+	assert.FileExists(t, filepath.Join(dir, BuildMarkerFilename))
+	assert.True(t, build())
+	assert.Equal(t, 1, builds())
+
+	// a source newer than its translation.
+	setModTime("a.gno", start.Add(2*time.Minute))
+	assert.False(t, build())
+	assert.Equal(t, 2, builds())
+	setModTime("a.gno", start)
+
+	// a translation newer than the last build.
+	setModTime("b.gno.gen.go", time.Now().Add(time.Minute))
+	assert.False(t, build())
+	setModTime("b.gno.gen.go", start.Add(time.Minute))
+	assert.True(t, build())
+	assert.Equal(t, 3, builds())
+
+	// a modified source, with its modtime unchanged.
+	err = os.WriteFile(filepath.Join(dir, "a.gno"), []byte("package foo\n\nvar A = 1\n"), 0o644)
+	assert.NoError(t, err)
+	setModTime("a.gno", start)
+	assert.False(t, build())
+	assert.Equal(t, 4, builds())
+}
@@ -0,0 +1,54 @@
+package gnolang
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// realmStateComment annotates the package-level variables of the
+// translations of realms, with PrecompileOptions.RealmMode.
+const realmStateComment = "// gno:realm-state: persisted by the gno VM between transactions; a plain global in go."
+
+// annotateRealmState annotates the package-level variable declarations of
+// f as realm state, and returns the names of the variables, sorted.
+//
+// The translation stays a plain go global: it is initialized once per go
+// process, and its changes are neither persisted nor rolled back when a
+// call panics, and the realm boundaries are not enforced, unlike in the gno
+// VM. It is only meant to run realms locally, e.g. in tests.
+func annotateRealmState(f *ast.File) []string {
+	var names []string
+	astutil.Apply(f, func(c *astutil.Cursor) bool {
+		switch node := c.Node().(type) {
+		case *ast.File:
+			return true
+		case *ast.GenDecl:
+			if node.Tok != token.VAR {
+				return false
+			}
+			for _, spec := range node.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					if name.Name != "_" {
+						names = append(names, name.Name)
+					}
+				}
+			}
+			// the comment is placed right before the declaration, after
+			// its doc comment if any.
+			f.Comments = append(f.Comments, &ast.CommentGroup{
+				List: []*ast.Comment{{Slash: node.Pos() - 1, Text: realmStateComment}},
+			})
+		}
+		// only the top-level declarations are package state.
+		return false
+	}, nil)
+
+	sort.Slice(f.Comments, func(i, j int) bool {
+		return f.Comments[i].Pos() < f.Comments[j].Pos()
+	})
+	sort.Strings(names)
+	return names
+}
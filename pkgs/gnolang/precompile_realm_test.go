@@ -0,0 +1,59 @@
+package gnolang
+
+import (
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecompileRealmMode(t *testing.T) {
+	source := `package counter
+
+import "strconv"
+
+// counter is incremented by Incr.
+var counter int
+
+var (
+	name, _ = "counter", 0
+)
+
+const max = 10
+
+func Incr() int {
+	var local int
+	counter++
+	local = counter
+	return local
+}
+
+func Render(path string) string {
+	return name + ": " + strconv.Itoa(counter)
+}
+`
+	res, err := PrecompileWithOptions(source, "gno", "counter.gno", PrecompileOptions{RealmMode: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"counter", "name"}, res.RealmState)
+	assert.Contains(t, res.Translated, "// counter is incremented by Incr.\n"+realmStateComment+"\nvar counter int\n")
+	assert.Contains(t, res.Translated, realmStateComment+"\nvar (\n\tname, _ = \"counter\", 0\n)\n")
+	assert.Contains(t, res.Translated, "\tvar local int\n")
+	assert.NotContains(t, res.Translated, realmStateComment+"\nconst")
+	assert.NotContains(t, res.Translated, realmStateComment+"\n\tvar local")
+
+	// the mode is off by default.
+	res, err = Precompile(source, "gno", "counter.gno")
+	require.NoError(t, err)
+	assert.Empty(t, res.RealmState)
+	assert.NotContains(t, res.Translated, realmStateComment)
+
+	// the annotated translation still builds.
+	mempkg := &std.MemPackage{
+		Name:  "counter",
+		Path:  "gno.land/r/demo/counter",
+		Files: []*std.MemFile{{Name: "counter.gno", Body: source}},
+	}
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, RealmMode: true, RootDir: t.TempDir()})
+	assert.NoError(t, err)
+}
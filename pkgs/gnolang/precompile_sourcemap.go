@@ -0,0 +1,86 @@
+package gnolang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+)
+
+// SourceMap maps line numbers of a precompiled .go file to the line numbers
+// of the .gno file it was generated from.
+type SourceMap map[int]int
+
+// SourceLine returns the .gno line matching the given generated line. Lines
+// that don't start a node (closing braces, blank lines) are mapped to the
+// nearest preceding mapped line. It returns 0 if no line matches.
+func (sm SourceMap) SourceLine(genLine int) int {
+	for line := genLine; line > 0; line-- {
+		if srcLine, ok := sm[line]; ok {
+			return srcLine
+		}
+	}
+	return 0
+}
+
+// RewriteLines rewrites every "<genFilename>:<line>" occurrence in output to
+// "<srcFilename>:<source line>", so that errors reported by the go toolchain
+// point to the original .gno file.
+func (sm SourceMap) RewriteLines(output, genFilename, srcFilename string) string {
+	re := regexp.MustCompile(regexp.QuoteMeta(genFilename) + `:(\d+)`)
+	return re.ReplaceAllStringFunc(output, func(match string) string {
+		genLine, err := strconv.Atoi(re.FindStringSubmatch(match)[1])
+		if err != nil {
+			return match
+		}
+		srcLine := sm.SourceLine(genLine)
+		if srcLine == 0 {
+			return match
+		}
+		return srcFilename + ":" + strconv.Itoa(srcLine)
+	})
+}
+
+// buildSourceMap computes the SourceMap between the transformed AST of a .gno
+// file and its translation, by walking the AST re-parsed from the translation
+// side by side with the original one.
+func buildSourceMap(fset *token.FileSet, node ast.Node, translated string) (SourceMap, error) {
+	genFset := token.NewFileSet()
+	genFile, err := parser.ParseFile(genFset, "", translated, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse translated source: %w", err)
+	}
+
+	srcNodes := collectSourceMapNodes(node)
+	genNodes := collectSourceMapNodes(genFile)
+	if len(srcNodes) != len(genNodes) {
+		return nil, fmt.Errorf("translated source doesn't match the transformed AST")
+	}
+
+	sm := SourceMap{}
+	for i, genNode := range genNodes {
+		genLine := genFset.Position(genNode.Pos()).Line
+		if _, ok := sm[genLine]; ok {
+			continue // keep the first node starting on a line.
+		}
+		sm[genLine] = fset.Position(srcNodes[i].Pos()).Line
+	}
+	return sm, nil
+}
+
+func collectSourceMapNodes(node ast.Node) []ast.Node {
+	var nodes []ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil:
+			return false
+		case *ast.Comment, *ast.CommentGroup:
+			return false // comments are not part of the parsed generated AST.
+		}
+		nodes = append(nodes, n)
+		return true
+	})
+	return nodes
+}
@@ -0,0 +1,54 @@
+package gnolang
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecompileSourceMap(t *testing.T) {
+	source := `package main
+
+import "std"
+
+
+
+func main() {
+	_ = std.GetChainID
+
+
+	panic("boom")
+}
+`
+	res, err := Precompile(source, "gno", "main.gno")
+	require.NoError(t, err)
+
+	sm, err := res.SourceMap()
+	require.NoError(t, err)
+
+	genLines := strings.Split(res.Translated, "\n")
+	lineOf := func(substr string) int {
+		for i, line := range genLines {
+			if strings.Contains(line, substr) {
+				return i + 1
+			}
+		}
+		t.Fatalf("%q not found in translated source", substr)
+		return 0
+	}
+
+	assert.Equal(t, 1, sm.SourceLine(lineOf("package main")))
+	assert.Equal(t, 3, sm.SourceLine(lineOf("stdshim")))
+	assert.Equal(t, 7, sm.SourceLine(lineOf("func main()")))
+	assert.Equal(t, 8, sm.SourceLine(lineOf("std.GetChainID")))
+	assert.Equal(t, 11, sm.SourceLine(lineOf(`panic("boom")`)))
+	assert.Equal(t, 0, sm.SourceLine(1)) // header
+
+	panicLine := lineOf(`panic("boom")`)
+	output := "panic: boom\n\nmain.main()\n\t/tmp/x/main.gno.gen.go:" + strconv.Itoa(panicLine) + " +0x25\n"
+	expected := "panic: boom\n\nmain.main()\n\t/tmp/x/main.gno:11 +0x25\n"
+	assert.Equal(t, expected, sm.RewriteLines(output, "/tmp/x/main.gno.gen.go", "/tmp/x/main.gno"))
+}
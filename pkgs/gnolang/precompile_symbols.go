@@ -0,0 +1,220 @@
+package gnolang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"go.uber.org/multierr"
+)
+
+// SymbolKind is the kind of declaration of a Symbol.
+type SymbolKind int
+
+const (
+	SymbolFunc SymbolKind = iota
+	SymbolMethod
+	SymbolConst
+	SymbolVar
+	SymbolType
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolFunc:
+		return "func"
+	case SymbolMethod:
+		return "method"
+	case SymbolConst:
+		return "const"
+	case SymbolVar:
+		return "var"
+	case SymbolType:
+		return "type"
+	default:
+		return fmt.Sprintf("SymbolKind(%d)", int(k))
+	}
+}
+
+// MarshalText encodes the kind as its name, for JSON outputs.
+func (k SymbolKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Symbol is an exported declaration of a package, as returned by
+// ExtractExportedSymbols.
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// Recv is the name of the receiver type of a method, prefixed with "*"
+	// for a pointer receiver.
+	Recv string `json:",omitempty"`
+	// Signature is the declaration without its doc comment and body, e.g.
+	// "func (c *Counter) Add(n int) int", "type Counter struct{...}" or
+	// "const Max int".
+	Signature string
+	Doc       string `json:",omitempty"`
+	Pos       token.Position
+	// Methods are the exported methods of a type, with value or pointer
+	// receivers, sorted by name.
+	Methods []Symbol `json:",omitempty"`
+}
+
+// ExtractExportedSymbols returns the exported declarations of the .gno files
+// of mempkg, in the order of the files and of the declarations. The methods
+// are returned in the Methods of their type rather than on their own, and the
+// methods of unexported types are omitted. The test files are skipped.
+//
+// The files are translated as by Precompile, so the package must precompile;
+// the returned positions are those of the .gno sources.
+func ExtractExportedSymbols(mempkg *std.MemPackage) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var errs error
+	for _, mfile := range mempkg.Files {
+		if !strings.HasSuffix(mfile.Name, ".gno") ||
+			strings.HasSuffix(mfile.Name, "_test.gno") ||
+			strings.HasSuffix(mfile.Name, "_filetest.gno") {
+			continue
+		}
+		res, err := PrecompileWithFset(fset, mfile.Body, NoHeaderTags, mfile.Name, DefaultPrecompileOptions())
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", mfile.Name, err))
+			continue
+		}
+		files = append(files, res.AST.(*ast.File))
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("extract symbols: %w", errs)
+	}
+
+	var symbols []Symbol
+	var methods []Symbol
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if !decl.Name.IsExported() {
+					continue
+				}
+				sym := Symbol{
+					Name:      decl.Name.Name,
+					Kind:      SymbolFunc,
+					Signature: nodeString(fset, &ast.FuncDecl{Recv: decl.Recv, Name: decl.Name, Type: decl.Type}),
+					Doc:       decl.Doc.Text(),
+					Pos:       fset.Position(decl.Pos()),
+				}
+				if decl.Recv != nil && len(decl.Recv.List) > 0 {
+					sym.Kind = SymbolMethod
+					sym.Recv = recvTypeName(decl.Recv.List[0].Type)
+					methods = append(methods, sym)
+					continue
+				}
+				symbols = append(symbols, sym)
+			case *ast.GenDecl:
+				symbols = append(symbols, genDeclSymbols(fset, decl)...)
+			}
+		}
+	}
+
+	// the methods may be declared in another file than their type.
+	for i := range symbols {
+		if symbols[i].Kind != SymbolType {
+			continue
+		}
+		for _, method := range methods {
+			if strings.TrimPrefix(method.Recv, "*") == symbols[i].Name {
+				symbols[i].Methods = append(symbols[i].Methods, method)
+			}
+		}
+		sort.Slice(symbols[i].Methods, func(a, b int) bool {
+			return symbols[i].Methods[a].Name < symbols[i].Methods[b].Name
+		})
+	}
+	return symbols, nil
+}
+
+// genDeclSymbols returns the exported consts, vars and types of decl.
+func genDeclSymbols(fset *token.FileSet, decl *ast.GenDecl) []Symbol {
+	var symbols []Symbol
+	for _, spec := range decl.Specs {
+		// the doc of an ungrouped declaration is the one of the decl.
+		doc := decl.Doc
+		if decl.Lparen.IsValid() {
+			doc = nil
+		}
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if !spec.Name.IsExported() {
+				continue
+			}
+			if spec.Doc != nil {
+				doc = spec.Doc
+			}
+			symbols = append(symbols, Symbol{
+				Name:      spec.Name.Name,
+				Kind:      SymbolType,
+				Signature: "type " + nodeString(fset, &ast.TypeSpec{Name: spec.Name, TypeParams: spec.TypeParams, Assign: spec.Assign, Type: spec.Type}),
+				Doc:       doc.Text(),
+				Pos:       fset.Position(spec.Pos()),
+			})
+		case *ast.ValueSpec:
+			if spec.Doc != nil {
+				doc = spec.Doc
+			}
+			kind := SymbolVar
+			if decl.Tok == token.CONST {
+				kind = SymbolConst
+			}
+			for _, name := range spec.Names {
+				if !name.IsExported() {
+					continue
+				}
+				signature := decl.Tok.String() + " " + name.Name
+				if spec.Type != nil {
+					signature += " " + nodeString(fset, spec.Type)
+				}
+				symbols = append(symbols, Symbol{
+					Name:      name.Name,
+					Kind:      kind,
+					Signature: signature,
+					Doc:       doc.Text(),
+					Pos:       fset.Position(name.Pos()),
+				})
+			}
+		}
+	}
+	return symbols
+}
+
+// recvTypeName returns the name of the receiver type expr, prefixed with "*"
+// if it is a pointer, without its type parameters.
+func recvTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + recvTypeName(expr.X)
+	case *ast.ParenExpr:
+		return recvTypeName(expr.X)
+	case *ast.IndexExpr:
+		return recvTypeName(expr.X)
+	case *ast.IndexListExpr:
+		return recvTypeName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	default:
+		return ""
+	}
+}
+
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
@@ -0,0 +1,112 @@
+package gnolang
+
+import (
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractExportedSymbols(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "counter",
+		Path: "gno.land/r/counter",
+		Files: []*std.MemFile{
+			{
+				Name: "counter.gno",
+				Body: `package counter
+
+import "std"
+
+// Max is the maximum count.
+const Max int = 10
+
+const (
+	// Zero is the initial count.
+	Zero = 0
+	one  = 1
+)
+
+var Owner std.Address
+
+// Counter counts.
+type Counter struct {
+	n int
+}
+
+type hidden struct{}
+
+func (h hidden) Exported() {}
+
+// New returns a new Counter.
+func New() *Counter { return &Counter{} }
+
+func helper() {}
+`,
+			},
+			{
+				Name: "methods.gno",
+				Body: `package counter
+
+// Add adds n to the count.
+func (c *Counter) Add(n int) int {
+	c.n += n
+	return c.n
+}
+
+func (c Counter) Get() int { return c.n }
+
+func (c *Counter) reset() { c.n = 0 }
+`,
+			},
+			{
+				Name: "counter_test.gno",
+				Body: "package counter\n\nfunc TestExported() {}\n",
+			},
+		},
+	}
+
+	symbols, err := ExtractExportedSymbols(mempkg)
+	require.NoError(t, err)
+
+	var names []string
+	for _, sym := range symbols {
+		names = append(names, sym.Kind.String()+" "+sym.Name)
+	}
+	assert.Equal(t, []string{"const Max", "const Zero", "var Owner", "type Counter", "func New"}, names)
+
+	assert.Equal(t, Symbol{
+		Name:      "Max",
+		Kind:      SymbolConst,
+		Signature: "const Max int",
+		Doc:       "Max is the maximum count.\n",
+		Pos:       symbols[0].Pos,
+	}, symbols[0])
+	assert.Equal(t, "counter.gno:6:7", symbols[0].Pos.String())
+	assert.Equal(t, "Zero is the initial count.\n", symbols[1].Doc)
+	assert.Equal(t, "var Owner std.Address", symbols[2].Signature)
+
+	counter := symbols[3]
+	assert.Equal(t, "type Counter struct {\n\tn int\n}", counter.Signature)
+	assert.Equal(t, "Counter counts.\n", counter.Doc)
+	if assert.Len(t, counter.Methods, 2) {
+		add := counter.Methods[0]
+		assert.Equal(t, "Add", add.Name)
+		assert.Equal(t, SymbolMethod, add.Kind)
+		assert.Equal(t, "*Counter", add.Recv)
+		assert.Equal(t, "func (c *Counter) Add(n int) int", add.Signature)
+		assert.Equal(t, "Add adds n to the count.\n", add.Doc)
+		assert.Equal(t, "methods.gno:4:1", add.Pos.String())
+
+		assert.Equal(t, "Get", counter.Methods[1].Name)
+		assert.Equal(t, "Counter", counter.Methods[1].Recv)
+	}
+
+	assert.Equal(t, "func New() *Counter", symbols[4].Signature)
+	assert.Equal(t, "New returns a new Counter.\n", symbols[4].Doc)
+
+	mempkg.Files = append(mempkg.Files, &std.MemFile{Name: "bad.gno", Body: "package counter\n\nimport \"reflect\"\n"})
+	_, err = ExtractExportedSymbols(mempkg)
+	assert.ErrorContains(t, err, "bad.gno")
+}
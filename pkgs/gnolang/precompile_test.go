@@ -2,13 +2,28 @@ package gnolang
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
 	"go/format"
 	"go/parser"
 	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gnolang/gno/pkgs/std"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/ast/astutil"
 )
 
 func TestPrecompile(t *testing.T) {
@@ -24,8 +39,8 @@ func TestPrecompile(t *testing.T) {
 			expectedOutput: "package foo\nfunc hello() string { return \"world\"}",
 		}, {
 			name:           "use-std",
-			source:         "package foo\nimport \"std\"\nfunc hello() string { _ = std.Foo\nreturn \"world\"}",
-			expectedOutput: "package foo\nimport \"github.com/gnolang/gno/stdlibs/stdshim\"\nfunc hello() string { _ = std.Foo\nreturn \"world\"}",
+			source:         "package foo\nimport \"std\"\nfunc hello() string { _ = std.GetHeight\nreturn \"world\"}",
+			expectedOutput: "package foo\nimport \"github.com/gnolang/gno/stdlibs/stdshim\"\nfunc hello() string { _ = std.GetHeight\nreturn \"world\"}",
 		}, {
 			name:           "use-realm",
 			source:         "package foo\nimport \"gno.land/r/users\"\nfunc foo()  { _ = users.Register}",
@@ -36,8 +51,8 @@ func TestPrecompile(t *testing.T) {
 			expectedOutput: "package foo\nimport \"github.com/gnolang/gno/examples/gno.land/p/demo/avl\"\nfunc foo() { _ = avl.Tree}",
 		}, {
 			name:           "use-named-std",
-			source:         "package foo\nimport bar \"std\"\nfunc hello() string { _ = bar.Foo\nreturn \"world\"}",
-			expectedOutput: "package foo\nimport bar \"github.com/gnolang/gno/stdlibs/stdshim\"\nfunc hello() string { _ = bar.Foo\nreturn \"world\"}",
+			source:         "package foo\nimport bar \"std\"\nfunc hello() string { _ = bar.GetHeight\nreturn \"world\"}",
+			expectedOutput: "package foo\nimport bar \"github.com/gnolang/gno/stdlibs/stdshim\"\nfunc hello() string { _ = bar.GetHeight\nreturn \"world\"}",
 		}, {
 			name:                      "blacklisted-package",
 			source:                    "package foo\nimport \"reflect\"\nfunc foo() { _ = reflect.ValueOf}",
@@ -62,11 +77,11 @@ func TestPrecompile(t *testing.T) {
 			assert.NoError(t, err)
 
 			// call preprocessor
-			transformed, err := precompileAST(fset, f, true)
+			transformed, _, err := precompileAST(fset, f, true, PrecompileOptions{})
 			if c.expectedPreprocessorError == nil {
 				assert.NoError(t, err)
 			} else {
-				assert.Equal(t, err, c.expectedPreprocessorError)
+				assert.EqualError(t, err, c.expectedPreprocessorError.Error())
 			}
 
 			// generate go
@@ -88,3 +103,1917 @@ func TestPrecompile(t *testing.T) {
 		})
 	}
 }
+
+func TestPrecompileDiagnostics(t *testing.T) {
+	source := "package foo\n\nimport (\n\t\"strings\"\n\t\"reflect\"\n)\n\nvar _ = strings.Title\nvar _ = reflect.ValueOf\n"
+
+	res, err := Precompile(source, "gno", "foo.gno")
+	assert.Error(t, err)
+	if assert.NotNil(t, res) && assert.Len(t, res.Diagnostics, 1) {
+		diag := res.Diagnostics[0]
+		assert.Equal(t, "foo.gno", diag.Pos.Filename)
+		assert.Equal(t, 5, diag.Pos.Line)
+		assert.Equal(t, 2, diag.Pos.Column)
+		assert.Equal(t, SeverityError, diag.Severity)
+		assert.Equal(t, `import "reflect" is not in the whitelist`, diag.Msg)
+		assert.Equal(t, `foo.gno:5:2: error: import "reflect" is not in the whitelist`, diag.String())
+	}
+
+	res, err = Precompile(source, "gno", "foo_test.gno")
+	assert.NoError(t, err)
+	assert.Empty(t, res.Diagnostics)
+}
+
+func TestPrecompileReportWriteJSON(t *testing.T) {
+	report := &PrecompileReport{
+		Files: []PrecompileFileReport{
+			{SourcePath: "foo.gno", TargetPath: "/out/foo.gno.gen.go", Written: true},
+			{
+				SourcePath: "bar.gno",
+				Diagnostics: []Diagnostic{{
+					Pos:      token.Position{Filename: "bar.gno", Line: 2, Column: 8},
+					Msg:      `import "reflect" is not in the whitelist`,
+					Severity: SeverityError,
+				}},
+				Error: `import "reflect" is not in the whitelist`,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := report.WriteJSON(&buf)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Files": [
+		{"SourcePath": "foo.gno", "TargetPath": "/out/foo.gno.gen.go", "Written": true},
+		{
+			"SourcePath": "bar.gno",
+			"Written": false,
+			"Diagnostics": [{
+				"Pos": {"Filename": "bar.gno", "Offset": 0, "Line": 2, "Column": 8},
+				"Msg": "import \"reflect\" is not in the whitelist",
+				"Severity": "error"
+			}],
+			"Error": "import \"reflect\" is not in the whitelist"
+		}
+	]}`, buf.String())
+}
+
+func TestPrecompileAST(t *testing.T) {
+	source := "package foo\n\nimport \"std\"\n\n// Foo returns the height.\nfunc Foo() int64 {\n\treturn std.GetHeight()\n}\n"
+	res, err := Precompile(source, "gno", "foo.gno")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the AST is the translation, without its header.
+	var out bytes.Buffer
+	err = format.Node(&out, res.Fset, res.AST)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(res.Translated, "\n\n"+out.String()))
+	assert.Contains(t, out.String(), `import "github.com/gnolang/gno/stdlibs/stdshim"`)
+
+	// the positions are those of the .gno source.
+	var foo *ast.FuncDecl
+	ast.Inspect(res.AST, func(n ast.Node) bool {
+		if fd, ok := n.(*ast.FuncDecl); ok {
+			foo = fd
+		}
+		return true
+	})
+	if assert.NotNil(t, foo) {
+		assert.Equal(t, "foo.gno:6:1", res.Fset.Position(foo.Pos()).String())
+		assert.Equal(t, "// Foo returns the height.\n", "// "+foo.Doc.Text())
+	}
+
+	res, err = Precompile("package foo\nimport \"reflect\"\n", "gno", "foo.gno")
+	assert.Error(t, err)
+	assert.Nil(t, res.AST)
+}
+
+func TestPrecompileWithFset(t *testing.T) {
+	fset := token.NewFileSet()
+	resA, err := PrecompileWithFset(fset, "package foo\n\nimport \"reflect\"\n", "gno", "a.gno", PrecompileOptions{})
+	assert.Error(t, err)
+	resB, err := PrecompileWithFset(fset, "package foo\n\nfunc B() {\n\tgo B()\n}\n", "gno", "b.gno", PrecompileOptions{})
+	assert.Error(t, err)
+
+	if assert.Len(t, resA.Diagnostics, 1) && assert.Len(t, resB.Diagnostics, 1) {
+		assert.Equal(t, "a.gno:3:8", resA.Diagnostics[0].Pos.String())
+		assert.Equal(t, "b.gno:4:2", resB.Diagnostics[0].Pos.String())
+	}
+	// both files are in the shared fset.
+	var files []string
+	fset.Iterate(func(f *token.File) bool {
+		files = append(files, f.Name())
+		return true
+	})
+	assert.Equal(t, []string{"a.gno", "b.gno"}, files)
+}
+
+func TestPrecompileSource(t *testing.T) {
+	var out bytes.Buffer
+	err := PrecompileSource(strings.NewReader("package foo\n"), &out, "foo_test.gno", PrecompileOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, GeneratedHeader+"\n\n//go:build gno && test\n// +build gno,test\n\npackage foo\n", out.String())
+
+	out.Reset()
+	err = PrecompileSource(strings.NewReader("package foo\nimport \"reflect\"\n"), &out, "foo.gno", PrecompileOptions{})
+	assert.EqualError(t, err, `import "reflect" is not in the whitelist`)
+	assert.Empty(t, out.String())
+}
+
+func TestPrecompileBuildConstraints(t *testing.T) {
+	cases := []struct {
+		name     string
+		source   string
+		tags     string
+		expected string
+	}{
+		{
+			name:     "go:build",
+			source:   "//go:build !race\n\npackage foo\n",
+			tags:     "gno",
+			expected: "//go:build gno && !race\n// +build gno,!race\n\npackage foo\n",
+		},
+		{
+			name:     "go:build and +build",
+			source:   "//go:build !race\n// +build !race\n\n// Package foo.\npackage foo\n",
+			tags:     "gno,test",
+			expected: "//go:build gno && test && !race\n// +build gno,test,!race\n\n// Package foo.\npackage foo\n",
+		},
+		{
+			name:     "+build",
+			source:   "// +build linux darwin\n\npackage foo\n",
+			tags:     "gno",
+			expected: "//go:build gno && (linux || darwin)\n// +build gno\n// +build linux darwin\n\npackage foo\n",
+		},
+		{
+			name:     "no tags",
+			source:   "//go:build !race\n\npackage foo\n",
+			expected: "//go:build !race\n// +build !race\n\npackage foo\n",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			res, err := Precompile(c.source, c.tags, "foo.gno")
+			if assert.NoError(t, err) {
+				assert.Equal(t, GeneratedHeader+"\n\n"+c.expected, res.Translated)
+			}
+		})
+	}
+
+	_, err := Precompile("//go:build (\n\npackage foo\n", "gno", "foo.gno")
+	assert.ErrorContains(t, err, `foo.gno: invalid build constraint "//go:build ("`)
+}
+
+func TestPrecompileHeaderTemplate(t *testing.T) {
+	opts := PrecompileOptions{
+		HeaderTemplate: "// Code generated by github.com/gnolang/gno from {{.SourcePath}}.\n// Translated at {{.Timestamp}}.",
+	}
+	res, err := PrecompileWithOptions("package foo\n", "gno", "bar/foo.gno", opts)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(res.Translated, "// Code generated by github.com/gnolang/gno from bar/foo.gno.\n// Translated at "))
+		assert.Contains(t, res.Translated, "\n\n//go:build gno\n")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo.gno.gen.go")
+	err = os.WriteFile(path, []byte(res.Translated), 0o644)
+	assert.NoError(t, err)
+	generated, err := IsGeneratedFile(path)
+	assert.NoError(t, err)
+	assert.True(t, generated)
+
+	opts.HeaderTemplate = "// Code generated by hand."
+	_, err = PrecompileWithOptions("package foo\n", "gno", "foo.gno", opts)
+	assert.EqualError(t, err, `header "// Code generated by hand." doesn't start with "// Code generated by github.com/gnolang/gno"`)
+
+	opts.HeaderTemplate = "{{.Unknown}}"
+	_, err = PrecompileWithOptions("package foo\n", "gno", "foo.gno", opts)
+	assert.ErrorContains(t, err, "execute header template")
+
+	res, err = Precompile("package foo\n", NoHeaderTags, "foo.gno")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "package foo\n", res.Translated)
+	}
+}
+
+func TestOutputNaming(t *testing.T) {
+	custom := OutputNaming(func(gnoFilename string) string {
+		return "gen_" + strings.TrimSuffix(gnoFilename, ".gno") + ".go"
+	})
+	cases := []struct {
+		name     string
+		naming   OutputNaming
+		expected []string
+	}{
+		{"default", nil, []string{"foo.gno.gen.go", ".foo_test.gno.gen_test.go", ".foo_filetest.gno.gen.go"}},
+		{"generated", GeneratedOutputNaming, []string{"foo.gno.gen.go", ".foo_test.gno.gen_test.go", ".foo_filetest.gno.gen.go"}},
+		{"pure", PureOutputNaming, []string{"foo.go", "foo_test.go", ".foo_filetest.go"}},
+		{"custom", custom, []string{"gen_foo.go", "gen_foo_test.go", "gen_foo_filetest.go"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, name := range []string{"foo.gno", "foo_test.gno", "foo_filetest.gno"} {
+				srcPath := filepath.Join(dir, name)
+				err := os.WriteFile(srcPath, []byte("package foo\n"), 0o644)
+				assert.NoError(t, err)
+
+				targetPath, err := PrecompileFile(srcPath, PrecompileOptions{OutputNaming: c.naming})
+				assert.NoError(t, err)
+				assert.Equal(t, filepath.Join(dir, c.expected[i]), targetPath)
+				assert.FileExists(t, targetPath)
+			}
+		})
+	}
+}
+
+func TestPrecompileFileOnFile(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "foo.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n\n// marker: todo\nvar Foo = 1\n"), 0o644)
+	assert.NoError(t, err)
+
+	var calls []string
+	opts := PrecompileOptions{
+		OnFile: func(srcPath, targetPath string, translated []byte) ([]byte, error) {
+			calls = append(calls, filepath.Base(srcPath)+" -> "+filepath.Base(targetPath))
+			return bytes.Replace(translated, []byte("// marker: todo"), []byte("// MARKER: TODO"), 1), nil
+		},
+	}
+	targetPath, err := PrecompileFile(srcPath, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.gno -> foo.gno.gen.go"}, calls)
+	out, err := os.ReadFile(targetPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "// MARKER: TODO\nvar Foo = 1\n")
+
+	// an error of the hook aborts the write.
+	assert.NoError(t, os.Remove(targetPath))
+	opts.OnFile = func(srcPath, targetPath string, translated []byte) ([]byte, error) {
+		return nil, errors.New("rejected")
+	}
+	_, err = PrecompileFile(srcPath, opts)
+	assert.EqualError(t, err, srcPath+": rejected")
+	assert.NoFileExists(t, targetPath)
+}
+
+// mapOutputFS is an in-memory OutputFS.
+type mapOutputFS map[string][]byte
+
+func (m mapOutputFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m[name] = data
+	return nil
+}
+
+func TestPrecompileFileOutputFS(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "foo.gno")
+	err := os.WriteFile(srcPath, []byte("package foo\n\nvar Foo = 1\n"), 0o644)
+	assert.NoError(t, err)
+
+	out := mapOutputFS{}
+	targetPath, err := PrecompileFile(srcPath, PrecompileOptions{OutputFS: out})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "foo.gno.gen.go"), targetPath)
+	assert.NoFileExists(t, targetPath)
+	assert.Len(t, out, 1)
+	assert.Contains(t, string(out[targetPath]), "var Foo = 1\n")
+}
+
+func TestPrecompileFileToWriter(t *testing.T) {
+	source := "package foo\n\nimport (\n\t\"std\"\n\t\"strings\"\n)\n\nvar _ = std.GetHeight\nvar _ = strings.ToUpper\n"
+
+	var out bytes.Buffer
+	imports, err := PrecompileFileToWriter([]byte(source), "foo.gno", &out, PrecompileOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"github.com/gnolang/gno/stdlibs/stdshim", "strings"}, imports)
+	assert.Contains(t, out.String(), "package foo\n")
+
+	out.Reset()
+	_, err = PrecompileFileToWriter([]byte("package foo\nimport \"reflect\"\n"), "foo.gno", &out, PrecompileOptions{})
+	assert.EqualError(t, err, `import "reflect" is not in the whitelist`)
+	assert.Empty(t, out.String())
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "foo_test.gno")
+	err = os.WriteFile(srcPath, []byte(source), 0o644)
+	assert.NoError(t, err)
+	targetPath, err := PrecompileFile(srcPath, PrecompileOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ".foo_test.gno.gen_test.go"), targetPath)
+	generated, err := IsGeneratedFile(targetPath)
+	assert.NoError(t, err)
+	assert.True(t, generated)
+}
+
+func TestPrecompileGoVersion(t *testing.T) {
+	res, err := PrecompileWithOptions("package foo\n", "gno,test", "foo_test.gno", PrecompileOptions{GoVersion: "go1.19"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, GeneratedHeader+"\n\n//go:build gno && test && go1.19\n// +build gno,test,go1.19\n\npackage foo\n", res.Translated)
+	}
+
+	for _, version := range []string{"1.19", "go1", "go1.019", "go2.0", "go1.19.1"} {
+		_, err = PrecompileWithOptions("package foo\n", "gno", "foo.gno", PrecompileOptions{GoVersion: version})
+		assert.EqualError(t, err, fmt.Sprintf("invalid go version %q: must be of the form go1.N", version))
+	}
+
+	// a version newer than the toolchain makes the build fail.
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n\nfunc Foo() {}\n"}},
+	}
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, GoVersion: "go1.19", RootDir: t.TempDir()})
+	assert.NoError(t, err)
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, GoVersion: "go1.999", RootDir: t.TempDir()})
+	assert.ErrorContains(t, err, "build constraints exclude all Go files")
+}
+
+func TestPrecompileStdShim(t *testing.T) {
+	StdShimRenames["GetOldHeight"] = "GetHeight"
+	defer delete(StdShimRenames, "GetOldHeight")
+
+	source := `package foo
+
+import gnostd "std"
+
+func Foo() {
+	_ = gnostd.GetOldHeight()
+	_ = gnostd.GetChainID()
+	_ = gnostd.TestSetOrigCaller
+	gnostd := struct{ Unknown int }{}
+	_ = gnostd.Unknown
+}
+`
+	res, err := Precompile(source, "gno", "foo.gno")
+	assert.EqualError(t, err, "foo.gno:8:6: std.TestSetOrigCaller has no equivalent in github.com/gnolang/gno/stdlibs/stdshim")
+	if assert.Len(t, res.Diagnostics, 1) {
+		assert.Equal(t, SeverityError, res.Diagnostics[0].Severity)
+	}
+
+	// only a warning in test files.
+	res, err = Precompile(source, "gno,test", "foo_test.gno")
+	assert.NoError(t, err)
+	assert.Contains(t, res.Translated, "_ = gnostd.GetHeight()\n")
+	if assert.Len(t, res.Diagnostics, 1) {
+		assert.Equal(t, SeverityWarning, res.Diagnostics[0].Severity)
+	}
+}
+
+func TestStdlibWhitelist(t *testing.T) {
+	natives := testStoreNativePackages(t)
+	for _, importPath := range stdlibWhitelist {
+		// gno provides the package, as a stdlib or natively.
+		stdlibDir := filepath.Join("../../stdlibs", filepath.FromSlash(importPath))
+		gnoFiles, _ := filepath.Glob(filepath.Join(stdlibDir, "*.gno"))
+		assert.True(t, len(gnoFiles) > 0 || natives[importPath], "%s is not a gno stdlib nor a native package", importPath)
+
+		if importPath == gnoStdPkgBefore {
+			// rewritten to the stdshim package.
+			assert.DirExists(t, "../../stdlibs/stdshim")
+			continue
+		}
+		// the translations import the go standard library package.
+		pkg, err := build.Default.Import(importPath, "", build.FindOnly)
+		if assert.NoError(t, err, importPath) {
+			assert.True(t, pkg.Goroot, "%s is not a standard library package", importPath)
+		}
+	}
+}
+
+// testStoreNativePackages returns the packages that the test store of
+// tests/imports.go defines natively, i.e. the cases of its switches. The file
+// is parsed, as the tests package imports gnolang.
+func testStoreNativePackages(t *testing.T) map[string]bool {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "../../tests/imports.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	natives := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if clause, ok := n.(*ast.CaseClause); ok {
+			for _, expr := range clause.List {
+				if lit, ok := expr.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					if pkgPath, err := strconv.Unquote(lit.Value); err == nil {
+						natives[pkgPath] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+	return natives
+}
+
+func TestStdShimSymbols(t *testing.T) {
+	files, err := filepath.Glob("../../stdlibs/stdshim/*.gno")
+	assert.NoError(t, err)
+	var symbols []string
+	for _, file := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for name := range f.Scope.Objects {
+			if ast.IsExported(name) {
+				symbols = append(symbols, name)
+			}
+		}
+	}
+	sort.Strings(symbols)
+	assert.Equal(t, symbols, stdShimSymbols)
+}
+
+func TestPrecompileImportNotWhitelisted(t *testing.T) {
+	_, err := Precompile("package foo\nimport \"reflect\"\nvar _ = reflect.ValueOf\n", "gno", "foo.gno")
+	var notWhitelisted *ImportNotWhitelistedError
+	if assert.True(t, errors.As(err, &notWhitelisted)) {
+		assert.Equal(t, "reflect", notWhitelisted.ImportPath)
+		assert.Equal(t, 2, notWhitelisted.Position.Line)
+	}
+
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "a.gno", Body: "package foo\nimport (\n\"os\"\n\"reflect\"\n)\nvar _, _ = os.Exit, reflect.ValueOf\n"},
+			{Name: "b.gno", Body: "package foo\nimport \"reflect\"\nvar _ = reflect.TypeOf\n"},
+		},
+	}
+	err = PrecompileAndCheckMempkg(mempkg)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"os", "reflect"}, NotWhitelistedImports(err))
+	assert.Contains(t, err.Error(), "imports not in the whitelist: os, reflect")
+}
+
+func TestPrecompileImportSuggestion(t *testing.T) {
+	cases := []struct {
+		importPath string
+		suggestion string
+	}{
+		{"string", "strings"},
+		{"fmtt", "fmt"},
+		{"math/rnd", "math/rand"},
+		{"encodng/jsn", "encoding/json"},
+		// too far from any whitelisted import.
+		{"reflect", ""},
+		{"encoding/csv", ""},
+		// no suggestion for the short ones.
+		{"os", ""},
+		{"net", ""},
+	}
+	for _, c := range cases {
+		source := fmt.Sprintf("package foo\nimport _ %q\n", c.importPath)
+		_, err := Precompile(source, "gno", "foo.gno")
+		var notWhitelisted *ImportNotWhitelistedError
+		if assert.True(t, errors.As(err, &notWhitelisted), c.importPath) {
+			assert.Equal(t, c.suggestion, notWhitelisted.Suggestion, c.importPath)
+		}
+	}
+
+	_, err := Precompile("package foo\nimport \"string\"\n", "gno", "foo.gno")
+	assert.EqualError(t, err, `import "string" is not in the whitelist, did you mean "strings"?`)
+}
+
+func TestPrecompileTestingImport(t *testing.T) {
+	source := "package foo\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {\n\tt.Errorf(\"foo\")\n}\n"
+	res, err := Precompile(source, "gno,test", "foo_test.gno")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, res.Translated, `import "github.com/gnolang/gno/stdlibs/testing"`)
+	if assert.Len(t, res.Imports, 1) {
+		assert.Equal(t, `"github.com/gnolang/gno/stdlibs/testing"`, res.Imports[0].Path.Value)
+	}
+
+	// the gno testing package is whitelisted.
+	_, err = Precompile("package foo\n\nimport \"testing\"\n\nvar _ = testing.Short\n", "gno", "foo.gno")
+	assert.NoError(t, err)
+}
+
+func TestPrecompileImportPaths(t *testing.T) {
+	// the alias and the quoting of the import paths don't matter.
+	source := "package foo\n\nimport (\n\tfoo \"strings\"\n\tgnostd `std`\n)\n\n" +
+		"func Foo() string { return foo.ToUpper(gnostd.GetChainID()) }\n"
+	res, err := Precompile(source, "gno", "foo.gno")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, res.Translated, `foo "strings"`)
+	assert.Contains(t, res.Translated, `gnostd "github.com/gnolang/gno/stdlibs/stdshim"`)
+	assert.Empty(t, res.Diagnostics)
+
+	_, err = Precompile("package foo\n\nimport foo `reflect`\n", "gno", "foo.gno")
+	assert.EqualError(t, err, `import "reflect" is not in the whitelist`)
+}
+
+func TestPrecompileImportAliases(t *testing.T) {
+	cases := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			"std",
+			"package foo\n\nimport gnostd \"std\"\n\nvar _ = gnostd.GetHeight\n",
+			"import gnostd \"github.com/gnolang/gno/stdlibs/stdshim\"\n\nvar _ = gnostd.GetHeight\n",
+		},
+		{
+			"p/demo",
+			"package foo\n\nimport tree \"gno.land/p/demo/avl\"\n\nvar _ tree.Tree\n",
+			"import tree \"github.com/gnolang/gno/examples/gno.land/p/demo/avl\"\n\nvar _ tree.Tree\n",
+		},
+		{
+			"r",
+			"package foo\n\nimport u \"gno.land/r/demo/users\"\n\nvar _ = u.GetUser\n",
+			"import u \"github.com/gnolang/gno/examples/gno.land/r/demo/users\"\n\nvar _ = u.GetUser\n",
+		},
+		{
+			"dot and blank",
+			"package foo\n\nimport (\n\t. \"gno.land/p/demo/avl\"\n\t_ \"gno.land/r/demo/users\"\n)\n\nvar _ Tree\n",
+			"import (\n\t. \"github.com/gnolang/gno/examples/gno.land/p/demo/avl\"\n\t_ \"github.com/gnolang/gno/examples/gno.land/r/demo/users\"\n)\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := Precompile(c.source, "gno", "foo.gno")
+			if assert.NoError(t, err) {
+				assert.Contains(t, res.Translated, c.expected)
+			}
+		})
+	}
+}
+
+func TestPrecompileUnusedImports(t *testing.T) {
+	// std is only shadowed, and strings is never used: once std is
+	// rewritten, go build would reject both.
+	source := `package foo
+
+import (
+	"std"
+	"strings"
+	str "strings"
+	_ "gno.land/p/demo/avl"
+
+	"gno.land/p/demo/ufmt"
+)
+
+func Foo() string {
+	std := "std"
+	return ufmt.Sprintf("%s", str.ToUpper(std))
+}
+`
+	res, err := Precompile(source, "gno", "foo.gno")
+	assert.NoError(t, err)
+	f, err := parser.ParseFile(token.NewFileSet(), "foo.gno.gen.go", res.Translated, parser.ImportsOnly)
+	assert.NoError(t, err)
+	var imports []string
+	for _, spec := range f.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.ElementsMatch(t, []string{
+		`"strings"`,
+		`"github.com/gnolang/gno/examples/gno.land/p/demo/avl"`,
+		`"github.com/gnolang/gno/examples/gno.land/p/demo/ufmt"`,
+	}, imports)
+	assert.Contains(t, res.Translated, "\tstr \"strings\"\n")
+	assert.NotContains(t, res.Translated, "stdshim")
+
+	// the imports are only pruned if PruneUnusedImports is set.
+	res, err = PrecompileWithOptions(source, "gno", "foo.gno", PrecompileOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, res.Translated, "stdshim")
+}
+
+func TestPrecompileUnusedImportsUnknownName(t *testing.T) {
+	// the packages of avl/v2 and bar are named avl and foo: the names of
+	// the packages outside of the standard library are not guessed from
+	// their path, and their imports are kept.
+	source := `package foo
+
+import (
+	"strings"
+
+	"gno.land/p/demo/avl/v2"
+	"gno.land/p/demo/bar"
+)
+
+var (
+	_ = avl.NewTree
+	_ = foo.Bar
+)
+`
+	res, err := Precompile(source, "gno", "foo.gno")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, res.Translated, `"strings"`)
+	assert.Contains(t, res.Translated, `"github.com/gnolang/gno/examples/gno.land/p/demo/avl/v2"`)
+	assert.Contains(t, res.Translated, `"github.com/gnolang/gno/examples/gno.land/p/demo/bar"`)
+}
+
+func TestPrecompileFixImports(t *testing.T) {
+	importsOf := func(translated string) []string {
+		f, err := parser.ParseFile(token.NewFileSet(), "foo.gno.gen.go", translated, parser.ImportsOnly)
+		assert.NoError(t, err)
+		var imports []string
+		for _, spec := range f.Imports {
+			imports = append(imports, spec.Path.Value)
+		}
+		return imports
+	}
+	opts := PrecompileOptions{FixImports: true}
+
+	// strings is referred to without being imported, e.g. by a
+	// transformation.
+	source := "package foo\n\nimport \"std\"\n\nvar _ = std.GetHeight\n\nfunc Foo() string { return strings.ToUpper(\"foo\") }\n"
+	res, err := PrecompileWithOptions(source, "gno", "foo.gno", opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{`"strings"`, `"github.com/gnolang/gno/stdlibs/stdshim"`}, importsOf(res.Translated))
+	// the stdshim is still imported without a name, as std.
+	assert.NotContains(t, res.Translated, "std \"github.com")
+	_, err = res.SourceMap()
+	assert.NoError(t, err)
+
+	// bytes is not referred to.
+	source = "package foo\n\nimport (\n\t\"bytes\"\n\t\"strings\"\n)\n\nfunc Foo() string { return strings.ToUpper(\"foo\") }\n"
+	res, err = PrecompileWithOptions(source, "gno", "foo.gno", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"strings"`}, importsOf(res.Translated))
+	_, err = res.SourceMap()
+	assert.NoError(t, err)
+}
+
+// renameCall renames the calls of the function from to to.
+type renameCall struct{ from, to string }
+
+func (r renameCall) Pre(c *astutil.Cursor) bool { return true }
+
+func (r renameCall) Post(c *astutil.Cursor) bool {
+	if call, ok := c.Node().(*ast.CallExpr); ok {
+		if fun, ok := call.Fun.(*ast.Ident); ok && fun.Name == r.from {
+			fun.Name = r.to
+		}
+	}
+	return true
+}
+
+func TestPrecompileTransforms(t *testing.T) {
+	source := `package foo
+
+import "std"
+
+func foo() std.Address { return std.GetOrigCaller() }
+
+func bar() std.Address { return foo() }
+`
+	var opts PrecompileOptions
+	opts.AddTransform(renameCall{from: "foo", to: "baz"})
+	// the transformers see the changes of the ones registered before.
+	opts.AddTransform(renameCall{from: "baz", to: "qux"})
+
+	res, err := PrecompileWithOptions(source, "gno", "foo.gno", opts)
+	assert.NoError(t, err)
+	assert.Contains(t, res.Translated, "func bar() std.Address { return qux() }")
+	assert.Equal(t, []Transformer{renameCall{"foo", "baz"}, renameCall{"baz", "qux"}}, opts.Transforms)
+}
+
+func TestPrecompileRewriteBuiltinPrint(t *testing.T) {
+	cases := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name: "fmt imported",
+			source: `package foo
+
+func foo() {
+	println("hello", 1)
+	print("world")
+}
+`,
+			expected: `package foo
+
+import "fmt"
+
+func foo() {
+	fmt.Println("hello", 1)
+	fmt.Print("world")
+}
+`,
+		},
+		{
+			name: "fmt already imported",
+			source: `package foo
+
+import gofmt "fmt"
+
+func foo() {
+	gofmt.Printf("%d", 1)
+	println("hello")
+}
+`,
+			expected: `package foo
+
+import gofmt "fmt"
+
+func foo() {
+	gofmt.Printf("%d", 1)
+	gofmt.Println("hello")
+}
+`,
+		},
+		{
+			name: "fmt shadowed",
+			source: `package foo
+
+func foo(fmt string) {
+	println(fmt)
+}
+`,
+			expected: `package foo
+
+import fmt1 "fmt"
+
+func foo(fmt string) {
+	fmt1.Println(fmt)
+}
+`,
+		},
+		{
+			name: "print declared",
+			source: `package foo
+
+func print(s string) {}
+
+func foo() {
+	print("hello")
+}
+`,
+			expected: `package foo
+
+func print(s string) {}
+
+func foo() {
+	print("hello")
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			res, err := PrecompileWithOptions(c.source, "gno", "foo.gno", PrecompileOptions{RewriteBuiltinPrint: true})
+			assert.NoError(t, err)
+			assert.Equal(t, GeneratedHeader+"\n\n//go:build gno\n// +build gno\n\n"+c.expected, res.Translated)
+		})
+	}
+
+	// the output of the program is told from its errors.
+	mempkg := &std.MemPackage{
+		Name:  "main",
+		Path:  "main",
+		Files: []*std.MemFile{{Name: "main.gno", Body: "package main\n\nfunc main() { println(\"hello\") }\n"}},
+	}
+	var stdout bytes.Buffer
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Run: true, RewriteBuiltinPrint: true, Stdout: &stdout})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", report.Output)
+	assert.Equal(t, "hello\n", stdout.String())
+}
+
+func TestPrecompileDeclOrder(t *testing.T) {
+	source := `package foo
+
+var a = next("a")
+
+func init() { next("init 1") }
+
+const c = 1
+
+var b = next("b")
+
+func init() { next("init 2") }
+
+type T struct{}
+
+func next(s string) string { return s }
+
+func init() { next("init 3") }
+`
+	declsOf := func(f *ast.File) []string {
+		var decls []string
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				decls = append(decls, decl.Name.Name+"@"+strconv.Itoa(int(decl.Pos())))
+			case *ast.GenDecl:
+				decls = append(decls, decl.Tok.String()+"@"+strconv.Itoa(int(decl.Pos())))
+			}
+		}
+		return decls
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "foo.gno", source, parser.ParseComments)
+	assert.NoError(t, err)
+	want := declsOf(f)
+
+	res, err := PrecompileWithFset(token.NewFileSet(), source, "gno", "foo.gno", PrecompileOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, want, declsOf(res.AST.(*ast.File)))
+	var inits []string
+	for _, line := range strings.Split(res.Translated, "\n") {
+		if strings.HasPrefix(line, "func init()") || strings.HasPrefix(line, "var ") {
+			inits = append(inits, line)
+		}
+	}
+	assert.Equal(t, []string{
+		`var a = next("a")`,
+		`func init() { next("init 1") }`,
+		`var b = next("b")`,
+		`func init() { next("init 2") }`,
+		`func init() { next("init 3") }`,
+	}, inits)
+
+	// the declarations moved by a transformation are sorted back, while
+	// the added ones stay in place.
+	added := &ast.GenDecl{Tok: token.VAR}
+	for i, j := 0, len(f.Decls)-1; i < j; i, j = i+1, j-1 {
+		f.Decls[i], f.Decls[j] = f.Decls[j], f.Decls[i]
+	}
+	f.Decls = append([]ast.Decl{f.Decls[0], added}, f.Decls[1:]...)
+	sortDeclsBySource(f)
+	assert.Equal(t, append([]string{want[0], "var@0"}, want[1:]...), declsOf(f))
+}
+
+func TestPrecompileSkipWhitelist(t *testing.T) {
+	source := "package foo\n\nimport \"encoding/csv\"\n\nvar _ = csv.NewReader\n"
+	_, err := Precompile(source, "gno", "foo.gno")
+	assert.Error(t, err)
+
+	// the check is skipped whatever the whitelist mode, and the files
+	// that would have been checked get a warning.
+	for _, mode := range []WhitelistMode{WhitelistEnforce, WhitelistWarn, WhitelistOff} {
+		res, err := PrecompileWithOptions(source, "gno", "foo.gno", PrecompileOptions{SkipWhitelist: true, WhitelistMode: mode})
+		if !assert.NoError(t, err, mode.String()) {
+			continue
+		}
+		assert.Contains(t, res.Translated, `import "encoding/csv"`)
+		assert.Equal(t, []Diagnostic{{
+			Pos:      token.Position{Filename: "foo.gno", Offset: 8, Line: 1, Column: 9},
+			Msg:      "import whitelist check skipped (SkipWhitelist is set)",
+			Severity: SeverityWarning,
+		}}, res.Diagnostics, mode.String())
+	}
+
+	res, err := PrecompileWithOptions(source, "gno", "foo_test.gno", PrecompileOptions{SkipWhitelist: true})
+	if assert.NoError(t, err) {
+		assert.Empty(t, res.Diagnostics)
+	}
+}
+
+func TestPrecompileWhitelistMode(t *testing.T) {
+	source := "package foo\n\nimport \"encoding/csv\"\n\nvar _ = csv.NewReader\n"
+	cases := []struct {
+		mode  WhitelistMode
+		err   string
+		diags []string
+	}{
+		{WhitelistEnforce, `import "encoding/csv" is not in the whitelist`, []string{
+			`foo.gno:3:8: error: import "encoding/csv" is not in the whitelist`,
+		}},
+		{WhitelistWarn, "", []string{
+			`foo.gno:3:8: warning: import "encoding/csv" is not in the whitelist (allowed in warn mode)`,
+		}},
+		{WhitelistOff, "", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.mode.String(), func(t *testing.T) {
+			res, err := PrecompileWithOptions(source, "gno", "foo.gno", PrecompileOptions{WhitelistMode: c.mode})
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+			} else if assert.NoError(t, err) {
+				assert.Contains(t, res.Translated, `import "encoding/csv"`)
+			}
+			var diags []string
+			for _, diag := range res.Diagnostics {
+				diags = append(diags, diag.String())
+			}
+			assert.Equal(t, c.diags, diags)
+		})
+	}
+}
+
+func TestPrecompileAndCheckMempkgFileNames(t *testing.T) {
+	for _, name := range []string{
+		"../foo.gno",
+		"../../etc/foo.gno",
+		"sub/foo.gno",
+		`sub\foo.gno`,
+		"/tmp/foo.gno",
+		"..",
+		"",
+	} {
+		mempkg := &std.MemPackage{
+			Name:  "foo",
+			Path:  "gno.land/p/demo/foo",
+			Files: []*std.MemFile{{Name: name, Body: "package foo\n"}},
+		}
+		err := PrecompileAndCheckMempkg(mempkg)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), "invalid file name", name)
+		}
+	}
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n"}},
+	}
+	assert.NoError(t, PrecompileAndCheckMempkg(mempkg))
+}
+
+func TestValidateMemPackage(t *testing.T) {
+	cases := []struct {
+		name  string
+		files []*std.MemFile
+		err   string
+	}{
+		{
+			name: "empty",
+			err:  "invalid package: no .gno files",
+		},
+		{
+			name:  "no gno files",
+			files: []*std.MemFile{{Name: "README.md"}},
+			err:   "invalid package: no .gno files",
+		},
+		{
+			name:  "duplicate name",
+			files: []*std.MemFile{{Name: "foo.gno"}, {Name: "bar.gno"}, {Name: "foo.gno"}},
+			err:   `duplicate file name "foo.gno"`,
+		},
+		{
+			name:  "hidden",
+			files: []*std.MemFile{{Name: ".foo.gno"}},
+			err:   `invalid file name ".foo.gno": must not be hidden`,
+		},
+		{
+			name:  "path",
+			files: []*std.MemFile{{Name: "../foo.gno"}},
+			err:   `invalid file name "../foo.gno": must not be empty, ".", ".." nor contain path separators`,
+		},
+		{
+			name:  "parent",
+			files: []*std.MemFile{{Name: "foo.gno"}, {Name: ".."}},
+			err:   `invalid file name "..": must not be empty, ".", ".." nor contain path separators`,
+		},
+		{
+			name:  "valid",
+			files: []*std.MemFile{{Name: "foo.gno"}, {Name: "foo_test.gno"}, {Name: "README.md"}},
+		},
+		{
+			name:  "go files and dots",
+			files: []*std.MemFile{{Name: "foo..gno"}, {Name: "foo.go"}, {Name: "foo.gen.go"}},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateMemPackage(&std.MemPackage{Name: "foo", Path: "gno.land/p/demo/foo", Files: c.files})
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+		})
+	}
+
+	// the package is validated before being precompiled.
+	err := PrecompileAndCheckMempkg(&std.MemPackage{Name: "foo", Path: "gno.land/p/demo/foo"})
+	assert.EqualError(t, err, "invalid package: no .gno files")
+	_, err = PrecompileMemPkg(&std.MemPackage{Name: "foo", Path: "gno.land/p/demo/foo"}, PrecompileOptions{})
+	assert.EqualError(t, err, "invalid package: no .gno files")
+}
+
+func TestPrecompileMemPkg(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "a.gno", Body: "package foo\n\nfunc A() int { return b() }\n"},
+			{Name: "b.gno", Body: "package foo\n\nfunc b() int { return 1 }\n"},
+			{Name: "README.md", Body: "# foo\n"},
+		},
+	}
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &PrecompileReport{Files: []PrecompileFileReport{
+		{SourcePath: "a.gno", TargetPath: "a.gno.gen.go"},
+		{SourcePath: "b.gno", TargetPath: "b.gno.gen.go"},
+	}}, report)
+
+	mempkg.Files[1].Body = "package foo\n\nfunc b() string { return \"\" }\n"
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "build package: ")
+		assert.Contains(t, err.Error(), "cannot use b()")
+	}
+
+	mempkg.Files[1].Body = "package foo\n\nimport \"reflect\"\n"
+	report, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true})
+	assert.EqualError(t, err, `precompile package: b.gno: import "reflect" is not in the whitelist`)
+	if assert.Len(t, report.Files, 2) {
+		assert.Empty(t, report.Files[0].Error)
+		assert.Equal(t, `import "reflect" is not in the whitelist`, report.Files[1].Error)
+		assert.Len(t, report.Files[1].Diagnostics, 1)
+	}
+}
+
+func TestPrecompileMemPkgBuildErrorPaths(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "a.gno", Body: "package foo\n\n// A is a.\nfunc A() int { return b() }\n"},
+			{Name: "foo_bar.gno", Body: "package foo\n\nfunc b() string { return \"\" }\n\nfunc C() int {\n\treturn \"c\"\n}\n"},
+			{Name: "main.gno", Body: "package foo\n\nvar _ int = \"main\"\n"},
+		},
+	}
+	_, err := PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "a.gno:4:23: cannot use b()")
+		assert.Contains(t, err.Error(), `foo_bar.gno:6:9: cannot use "c"`)
+		assert.Contains(t, err.Error(), `main.gno:3:13: cannot use "main"`)
+		assert.NotContains(t, err.Error(), ".gno.gen.go")
+		assert.NotContains(t, err.Error(), os.TempDir())
+	}
+}
+
+func TestPrecompileMemPkgTest(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "foo.gno", Body: "package foo\n\nfunc Foo() int { return 42 }\n"},
+			{Name: "foo_test.gno", Body: `package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	if Foo() != 42 {
+		t.Errorf("Foo() = %d", Foo())
+	}
+}
+
+func TestBar(t *testing.T) {
+	t.Run("sub", func(t *testing.T) {
+		t.Errorf("bar")
+	})
+}
+`},
+			// the filetests are not run.
+			{Name: "z_filetest.gno", Body: "package main\n\nfunc main() { panic(1) }\n"},
+		},
+	}
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Test: true})
+	assert.EqualError(t, err, "test package: 1 of 2 tests failed")
+	if assert.Len(t, report.Tests, 2) {
+		assert.Equal(t, "TestFoo", report.Tests[0].Name)
+		assert.True(t, report.Tests[0].Passed)
+		assert.Equal(t, "TestBar", report.Tests[1].Name)
+		assert.False(t, report.Tests[1].Passed)
+		assert.Contains(t, report.Tests[1].Output, "foo_test.gno:13: bar")
+	}
+
+	mempkg.Files[1].Body = "package foo\n\nvar _ int = \"\"\n"
+	report, err = PrecompileMemPkg(mempkg, PrecompileOptions{Test: true})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "test package: std go compiler: ")
+		assert.Contains(t, err.Error(), "foo_test.gno:3:13: cannot use")
+	}
+	assert.Empty(t, report.Tests)
+}
+
+func TestPrecompileMemPkgRun(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "main",
+		Path: "main",
+		Files: []*std.MemFile{
+			{Name: "main.gno", Body: `package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func main() {
+	flag.Parse()
+	fmt.Println("echo:", flag.Arg(0))
+}
+`},
+		},
+	}
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Run: true, Args: []string{"hello", "world"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", report.Output)
+
+	// os is not whitelisted, but needed to read the standard input.
+	mempkg.Files[0].Body = `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	input, _ := io.ReadAll(os.Stdin)
+	fmt.Printf("read: %s", input)
+	if len(input) == 0 {
+		panic("empty input")
+	}
+}
+`
+	report, err = PrecompileMemPkg(mempkg, PrecompileOptions{Run: true, SkipWhitelist: true, Stdin: strings.NewReader("some input\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, "read: some input\n", report.Output)
+
+	// the errors of the program are reported, pointing to the .gno source.
+	report, err = PrecompileMemPkg(mempkg, PrecompileOptions{Run: true, SkipWhitelist: true})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "run package: go run: ")
+	}
+	assert.Contains(t, report.Output, "panic: empty input")
+	assert.Contains(t, report.Output, "main.gno:13")
+}
+
+func TestPrecompileMemPkgRunMultipleFiles(t *testing.T) {
+	// the files are all written before the package is run once.
+	mempkg := &std.MemPackage{
+		Name: "main",
+		Path: "main",
+		Files: []*std.MemFile{
+			{Name: "helper.gno", Body: "package main\n\nfunc greet(name string) string { return \"hello \" + name }\n"},
+			{Name: "main.gno", Body: "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(greet(name)) }\n"},
+			{Name: "vars.gno", Body: "package main\n\nvar name = \"gno\"\n"},
+		},
+	}
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Run: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello gno\n", report.Output)
+	assert.Len(t, report.Files, 3)
+}
+
+func TestPrecompileMemPkgAnonymous(t *testing.T) {
+	// the main packages may have no path.
+	mempkg := &std.MemPackage{
+		Name: "main",
+		Files: []*std.MemFile{
+			{Name: "main.gno", Body: "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n"},
+			{Name: "main_test.gno", Body: "package main\n\nimport \"testing\"\n\nfunc TestMain(t *testing.T) { main() }\n"},
+		},
+	}
+	report, err := PrecompileMemPkg(mempkg, PrecompileOptions{Run: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", report.Output)
+
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true})
+	assert.NoError(t, err)
+
+	report, err = PrecompileMemPkg(mempkg, PrecompileOptions{Test: true})
+	assert.NoError(t, err)
+	if assert.Len(t, report.Tests, 1) {
+		assert.True(t, report.Tests[0].Passed)
+	}
+}
+
+func TestRewriteTempPaths(t *testing.T) {
+	tmpDir := filepath.Join(os.TempDir(), "gno-precompile123")
+	var translations []memPkgTranslation
+	for _, name := range []string{"foo.gno", "foo_test.gno", "bar.gno"} {
+		targetName, tags := GetPrecompileFilenameAndTags(name)
+		res, err := Precompile("package foo\n\nvar _ = 1\n", tags, name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		translations = append(translations, memPkgTranslation{srcName: name, targetName: targetName, res: res})
+	}
+
+	// the generated var declarations are below the header and build tags.
+	out := rewriteTempPaths(
+		filepath.Join(tmpDir, "foo.gno.gen.go")+":8:5: x\n"+
+			"./.foo_test.gno.gen_test.go:8:5: y\n"+
+			"./bar.gno.gen.go:8:5: z\n"+
+			filepath.Join(tmpDir, "go.mod")+":1: w\n",
+		tmpDir, translations)
+	assert.Equal(t, "foo.gno:3:5: x\nfoo_test.gno:3:5: y\nbar.gno:3:5: z\ngo.mod:1: w\n", out)
+}
+
+func TestPrecompileMemPkgGnoImports(t *testing.T) {
+	// a fake clone of gno, with a precompiled demo package.
+	rootDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(rootDir, "go.mod"), []byte("module "+ImportPrefix+"\n\ngo 1.19\n"), 0o644)
+	assert.NoError(t, err)
+	barDir := filepath.Join(rootDir, "examples", "gno.land", "p", "demo", "bar")
+	assert.NoError(t, os.MkdirAll(barDir, 0o755))
+	err = os.WriteFile(filepath.Join(barDir, "bar.gno.gen.go"), []byte("package bar\n\nfunc Bar() int { return 1 }\n"), 0o644)
+	assert.NoError(t, err)
+
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "foo.gno", Body: "package foo\n\nimport \"gno.land/p/demo/bar\"\n\nfunc Foo() int { return bar.Bar() }\n"},
+		},
+	}
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, RootDir: rootDir})
+	assert.NoError(t, err)
+}
+
+func TestPrecompileMempkgToSources(t *testing.T) {
+	mempkg := &std.MemPackage{
+		Name: "foo",
+		Path: "gno.land/p/demo/foo",
+		Files: []*std.MemFile{
+			{Name: "foo.gno", Body: "package foo\nimport \"std\"\nvar _ = std.GetChainID\n"},
+			{Name: "foo_test.gno", Body: "package foo\nimport \"testing\"\nfunc TestFoo(t *testing.T) {}\n"},
+			{Name: "README.md", Body: "# foo"},
+		},
+	}
+	sources, err := PrecompileMempkgToSources(mempkg)
+	assert.NoError(t, err)
+	assert.Len(t, sources, 2)
+	assert.Contains(t, sources["foo.gno.gen.go"], "//go:build gno\n")
+	assert.Contains(t, sources["foo.gno.gen.go"], `import "github.com/gnolang/gno/stdlibs/stdshim"`)
+	assert.Contains(t, sources[".foo_test.gno.gen_test.go"], "//go:build gno && test\n")
+
+	mempkg.Files = append(mempkg.Files, &std.MemFile{Name: "bar.gno", Body: "package foo\nimport \"reflect\"\n"})
+	sources, err = PrecompileMempkgToSources(mempkg)
+	assert.EqualError(t, err, `precompile package: bar.gno: import "reflect" is not in the whitelist`)
+	assert.Nil(t, sources)
+}
+
+func TestPrecompileRewriteRules(t *testing.T) {
+	opts := PrecompileOptions{
+		RewriteRules: RewriteRules{
+			{Before: "std", After: "example.com/gno/stdshim"},
+			{Before: "gno.land/r/", After: "example.com/gno/r/"},
+		},
+	}
+	source := "package foo\nimport (\n\"std\"\n\"gno.land/r/users\"\n)\nvar _, _ = std.GetHeight, users.Register\n"
+
+	res, err := PrecompileWithOptions(source, "", "foo.gno", opts)
+	assert.NoError(t, err)
+	assert.Contains(t, res.Translated, `"example.com/gno/stdshim"`)
+	assert.Contains(t, res.Translated, `"example.com/gno/r/users"`)
+
+	// p/demo packages are not rewritten nor whitelisted anymore.
+	_, err = PrecompileWithOptions("package foo\nimport \"gno.land/p/demo/avl\"\nvar _ = avl.Tree\n", "", "foo.gno", opts)
+	assert.EqualError(t, err, `import "gno.land/p/demo/avl" is not in the whitelist`)
+}
+
+func TestRewriteRulesValidate(t *testing.T) {
+	assert.NoError(t, DefaultRewriteRules.Validate())
+
+	cases := []struct {
+		name  string
+		rules RewriteRules
+		err   string
+	}{
+		{"empty-before", RewriteRules{{Before: "", After: "foo"}}, "rewrite rule #0: empty before path"},
+		{"empty-after", RewriteRules{{Before: "foo", After: ""}}, `rewrite rule "foo": empty after path`},
+		{"prefix-mismatch", RewriteRules{{Before: "foo/", After: "bar"}}, `rewrite rule "foo/": before and after paths must both end with a slash, or neither`},
+		{"duplicate", RewriteRules{{Before: "foo", After: "bar"}, {Before: "foo", After: "baz"}}, `rewrite rules "foo" and "foo" overlap`},
+		{"nested-prefix", RewriteRules{{Before: "gno.land/", After: "a/"}, {Before: "gno.land/r/", After: "b/"}}, `rewrite rules "gno.land/" and "gno.land/r/" overlap`},
+		{"exact-in-prefix", RewriteRules{{Before: "gno.land/r/foo", After: "a"}, {Before: "gno.land/r/", After: "b/"}}, `rewrite rules "gno.land/r/foo" and "gno.land/r/" overlap`},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			assert.EqualError(t, c.rules.Validate(), c.err)
+		})
+	}
+}
+
+func TestPrecompileComments(t *testing.T) {
+	source := `// Copyright 2023 license header.
+
+// Package foo does things.
+package foo
+
+import (
+	// the std package
+	"std" // trailing
+
+	"gno.land/p/demo/avl" /* block */
+)
+
+// floating comment
+
+// Foo is documented.
+func Foo() {
+	// inner
+	_ = std.GetHeight // after
+	_ = avl.Tree
+}
+
+// final floating comment
+`
+	countComments := func(src string) int {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+		assert.NoError(t, err)
+		count := 0
+		for _, cg := range f.Comments {
+			count += len(cg.List)
+		}
+		return count
+	}
+
+	res, err := Precompile(source, "gno", "foo.gno")
+	assert.NoError(t, err)
+
+	// the generated header adds the "Code generated" line and the build tags.
+	assert.Equal(t, countComments(source)+3, countComments(res.Translated))
+	assert.Contains(t, res.Translated, "// Copyright 2023 license header.\n\n// Package foo does things.\npackage foo\n")
+	assert.Contains(t, res.Translated, "// floating comment\n")
+	assert.Contains(t, res.Translated, "// final floating comment\n")
+}
+
+func TestCleanGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo.gno":                   "package foo\n",
+		"foo.gno.gen.go":            GeneratedHeader + "\n\npackage foo\n",
+		".foo_test.gno.gen_test.go": GeneratedHeader + "\n\npackage foo\n",
+		"foo.go":                    "package foo\n",
+		"bar.go":                    "// Code generated by another tool. DO NOT EDIT.\n\npackage foo\n",
+		"baz.go":                    "package foo\n\n" + GeneratedHeader + "\n",
+		"empty.go":                  "",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, CleanGeneratedFiles(dir))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	assert.Equal(t, []string{"bar.go", "baz.go", "empty.go", "foo.gno", "foo.go"}, remaining)
+}
+
+func TestPrecompileClean(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"foo.gno":                   "package foo\n",
+		"foo.gno.gen.go":            GeneratedHeader + "\n\npackage foo\n",
+		"foo.go":                    "package foo\n",
+		"sub/bar.gno.gen.go":        GeneratedHeader + "\n\npackage bar\n",
+		"sub/.bar_test.gno.gen.go":  GeneratedHeader + "\n\npackage bar\n",
+		"sub/bar.go":                "// Code generated by another tool. DO NOT EDIT.\n\npackage bar\n",
+		"sub/deep/baz.gno.gen.go":   GeneratedHeader + "\n\npackage baz\n",
+		".hidden/qux.gno.gen.go":    GeneratedHeader + "\n\npackage qux\n",
+		"sub/not_go.gno.gen.go.txt": GeneratedHeader + "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	removed, err := PrecompileClean(root, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "foo.gno.gen.go")}, removed)
+
+	removed, err = PrecompileClean(root, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(root, "sub", ".bar_test.gno.gen.go"),
+		filepath.Join(root, "sub", "bar.gno.gen.go"),
+		filepath.Join(root, "sub", "deep", "baz.gno.gen.go"),
+	}, removed)
+
+	for _, name := range []string{"foo.gno", "foo.go", "sub/bar.go", ".hidden/qux.gno.gen.go", "sub/not_go.gno.gen.go.txt"} {
+		assert.FileExists(t, filepath.Join(root, filepath.FromSlash(name)))
+	}
+
+	_, err = PrecompileClean(filepath.Join(root, "nonexistent"), true)
+	assert.Error(t, err)
+}
+
+func TestPrecompileBuildPackageContext(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "foo.gno.gen.go"), []byte(GeneratedHeader+"\n\n//go:build gno\n\npackage foo\n"), 0o644)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = PrecompileBuildPackageContext(ctx, dir, "go")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPrecompileBuildTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the looping go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	err := os.WriteFile(goBinary, []byte("#!/bin/sh\nwhile :; do :; done\n"), 0o755)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "foo.gno.gen.go"), []byte(GeneratedHeader+"\n\n//go:build gno\n\npackage foo\n"), 0o644)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = PrecompileBuildPackageContext(ctx, dir, goBinary)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n"}},
+	}
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{
+		Gobuild:    true,
+		GoBinary:   goBinary,
+		RunTimeout: 100 * time.Millisecond,
+	})
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestPrecompileGoNotFound(t *testing.T) {
+	const goBinary = "gno-test-no-such-go"
+	const msg = `go toolchain not found: "gno-test-no-such-go" is not an executable; set --go-binary or install Go`
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "foo.gno.gen.go"), []byte(GeneratedHeader+"\n\n//go:build gno\n\npackage foo\n"), 0o644)
+	assert.NoError(t, err)
+	err = PrecompileBuildPackage(dir, goBinary)
+	assert.ErrorIs(t, err, ErrGoNotFound)
+	assert.EqualError(t, err, msg)
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n"}},
+	}
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{Gobuild: true, GoBinary: goBinary})
+	assert.ErrorIs(t, err, ErrGoNotFound)
+
+	path, err := LookGoBinary("")
+	if err == nil {
+		assert.True(t, filepath.IsAbs(path))
+	}
+}
+
+func TestPrecompileMemPkgStreamOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\necho building\necho broken >&2\nexit 1\n"
+	err := os.WriteFile(goBinary, []byte(script), 0o755)
+	assert.NoError(t, err)
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n"}},
+	}
+	var stdout, stderr bytes.Buffer
+	_, err = PrecompileMemPkg(mempkg, PrecompileOptions{
+		Gobuild:  true,
+		GoBinary: goBinary,
+		RootDir:  t.TempDir(),
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+	})
+	assert.Error(t, err)
+	// the order of stdout and stderr in the error is not deterministic.
+	assert.Contains(t, err.Error(), "building\n")
+	assert.Contains(t, err.Error(), "broken\n")
+	assert.Equal(t, "building\n", stdout.String())
+	assert.Equal(t, "broken\n", stderr.String())
+}
+
+func TestPrecompileMemPkgBuildEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	script := "#!/bin/sh\necho \"GNO_CUSTOM=$GNO_CUSTOM GOFLAGS=$GOFLAGS HOME=$HOME\"\n"
+	err := os.WriteFile(goBinary, []byte(script), 0o755)
+	assert.NoError(t, err)
+	t.Setenv("GOFLAGS", "-mod=vendor")
+	t.Setenv("HOME", "/home/gno")
+
+	mempkg := &std.MemPackage{
+		Name:  "main",
+		Path:  "main",
+		Files: []*std.MemFile{{Name: "main.gno", Body: "package main\n\nfunc main() {}\n"}},
+	}
+	opts := PrecompileOptions{Run: true, GoBinary: goBinary, RootDir: t.TempDir()}
+
+	// the environment is inherited by default.
+	report, err := PrecompileMemPkg(mempkg, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "GNO_CUSTOM= GOFLAGS=-mod=vendor HOME=/home/gno\n", report.Output)
+
+	// but the essential variables, the environment is replaced by BuildEnv.
+	opts.BuildEnv = []string{"GNO_CUSTOM=foo"}
+	report, err = PrecompileMemPkg(mempkg, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "GNO_CUSTOM=foo GOFLAGS= HOME=/home/gno\n", report.Output)
+
+	opts.BuildEnv = []string{"HOME=/home/other"}
+	report, err = PrecompileMemPkg(mempkg, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "GNO_CUSTOM= GOFLAGS= HOME=/home/other\n", report.Output)
+}
+
+func TestPrecompileMemPkgWorkDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	goBinary := filepath.Join(t.TempDir(), "go")
+	err := os.WriteFile(goBinary, []byte("#!/bin/sh\nexit 1\n"), 0o755)
+	assert.NoError(t, err)
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n"}},
+	}
+	workDir := filepath.Join(t.TempDir(), "work")
+	opts := PrecompileOptions{
+		Gobuild:  true,
+		GoBinary: goBinary,
+		RootDir:  t.TempDir(),
+		WorkDir:  workDir,
+	}
+	_, err = PrecompileMemPkg(mempkg, opts)
+	assert.ErrorContains(t, err, "build package: std go compiler: ")
+
+	// the generated files are kept for inspection.
+	assert.FileExists(t, filepath.Join(workDir, "go.mod"))
+	assert.FileExists(t, filepath.Join(workDir, "foo.gno.gen.go"))
+
+	// the files of a previous build are not overwritten.
+	_, err = PrecompileMemPkg(mempkg, opts)
+	assert.EqualError(t, err, "build package: work dir "+workDir+" is not empty")
+}
+
+func TestPrecompileUnsupportedConstructs(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"goroutine", "package foo\nfunc foo() {\n\tgo foo()\n}\n", "foo.gno:3:2: goroutines are not supported"},
+		{"select", "package foo\nfunc foo() {\n\tselect {}\n}\n", "foo.gno:3:2: select statements are not supported"},
+		{"send", "package foo\nfunc foo(c chan int) {\n\tc <- 1\n}\n", "foo.gno:3:2: channel send statements are not supported"},
+		{"generic-func", "package foo\nfunc foo[T any](t T) {}\n", "foo.gno:2:1: type parameters are not supported"},
+		{"generic-type", "package foo\ntype Foo[T any] struct{}\n", "foo.gno:2:6: type parameters are not supported"},
+		{"std-emit", "package foo\nimport \"std\"\nfunc foo() {\n\tstd.Emit(\"foo\")\n}\n", "foo.gno:4:2: std.Emit calls are not supported"},
+		{"realm-type-assert", "package foo\nimport \"gno.land/r/demo/bar\"\nfunc foo(x interface{}) {\n\t_ = x.(*bar.Bar)\n}\n", "foo.gno:4:6: type assertions to realm types are not supported"},
+		{"named-realm-type-assert", "package foo\nimport baz \"gno.land/r/demo/bar\"\nfunc foo(x interface{}) {\n\t_ = x.(baz.Bar)\n}\n", "foo.gno:4:6: type assertions to realm types are not supported"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			res, err := Precompile(c.source, "gno", "foo.gno")
+			assert.EqualError(t, err, c.err)
+			if assert.NotNil(t, res) && assert.Len(t, res.Diagnostics, 1) {
+				assert.Equal(t, c.err, res.Diagnostics[0].Pos.String()+": "+res.Diagnostics[0].Msg)
+			}
+		})
+	}
+}
+
+func TestPrecompileBuildPackage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/foo\n\ngo 1.19\n",
+		// a.gno and b.gno reference each other.
+		"a.gno": "package foo\n\nfunc A() int { return b() }\n",
+		"b.gno": "package foo\n\nfunc b() int { return 42 }\n\nfunc B() int { return A() }\n",
+		// test files don't compile in the package build.
+		"a_test.gno":     "package foo\n\nvar _ = undefined\n",
+		"z_filetest.gno": "package main\n\nvar _ = undefined\n",
+	}
+	for name, content := range files {
+		if strings.HasSuffix(name, ".gno") {
+			targetFilename, tags := GetPrecompileFilenameAndTags(name)
+			res, err := Precompile(content, tags, name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			name, content = targetFilename, res.Translated
+		}
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, PrecompileBuildPackage(dir, "go"))
+	assert.NoError(t, PrecompileBuildPackage(filepath.Join(dir, "b.gno.gen.go"), "go"))
+
+	err := os.WriteFile(filepath.Join(dir, "c.gno.gen.go"), []byte(GeneratedHeader+"\n\n//go:build gno\n\npackage foo\n\nvar _ = undefined\n"), 0o644)
+	assert.NoError(t, err)
+	err = PrecompileBuildPackage(dir, "go")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "undefined: undefined")
+		var exitErr *exec.ExitError
+		if assert.True(t, errors.As(err, &exitErr)) {
+			assert.Equal(t, 1, exitErr.ExitCode())
+		}
+	}
+}
+
+func TestPrecompileBuildPackageDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.19\n"), 0o644)
+	assert.NoError(t, err)
+	files := map[string]string{
+		"foo.gno": "package foo\n\nfunc Foo() int {\n\treturn bar(1)\n}\n",
+		"bar.gno": "package foo\n\n// bar is broken.\nfunc bar(n int) string {\n\treturn n\n}\n",
+	}
+	for name, content := range files {
+		srcPath := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(srcPath, []byte(content), 0o644))
+		_, err := PrecompileFile(srcPath, PrecompileOptions{})
+		assert.NoError(t, err)
+	}
+
+	err = PrecompileBuildPackage(dir, "go")
+	var buildErr *BuildError
+	if !assert.True(t, errors.As(err, &buildErr)) {
+		return
+	}
+	// the generated files start with a header: the lines only match once
+	// mapped to the .gno sources.
+	assert.Contains(t, buildErr.Output, "bar.gno.gen.go:")
+	positions := map[string]string{}
+	for _, diag := range buildErr.Diagnostics {
+		assert.Equal(t, SeverityError, diag.Severity)
+		positions[filepath.Base(diag.Pos.Filename)] = fmt.Sprintf("%d:%d: %s", diag.Pos.Line, diag.Pos.Column, diag.Msg)
+	}
+	assert.Equal(t, map[string]string{
+		"foo.gno": "4:9: cannot use bar(1) (value of type string) as int value in return statement",
+		"bar.gno": "5:9: cannot use n (variable of type int) as string value in return statement",
+	}, positions)
+	assert.Equal(t, filepath.Join(dir, "bar.gno"), buildErr.Diagnostics[0].Pos.Filename)
+}
+
+func TestParseBuildDiagnostics(t *testing.T) {
+	out := "# example.com/foo\n" +
+		"./foo.go:3:2: undefined: x\n" +
+		"/abs/bar.go:7: too many arguments in call to f\n" +
+		"\thave (int, int)\n" +
+		"\twant (int)\n"
+	diags := parseBuildDiagnostics(out, "/pkg")
+	assert.Equal(t, []Diagnostic{
+		{Pos: token.Position{Filename: filepath.Join("/pkg", "foo.go"), Line: 3, Column: 2}, Msg: "undefined: x"},
+		{Pos: token.Position{Filename: "/abs/bar.go", Line: 7}, Msg: "too many arguments in call to f\nhave (int, int)\nwant (int)"},
+	}, diags)
+}
+
+func TestGuessRootDir(t *testing.T) {
+	ctx := context.Background()
+	opts := PrecompileOptions{Offline: true}
+
+	// in the gno module, the root is the clone.
+	rootDir, err := guessRootDir(ctx, ".", "go", opts)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(rootDir, "pkgs", "gnolang", "precompile.go"))
+
+	// in another module, the root is the nearest module above.
+	modDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(modDir, "go.mod"), []byte("module example.com/realm\n\ngo 1.19\n"), 0o644)
+	assert.NoError(t, err)
+	pkgDir := filepath.Join(modDir, "r", "foo")
+	assert.NoError(t, os.MkdirAll(pkgDir, 0o755))
+	rootDir, err = guessRootDir(ctx, pkgDir, "go", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, modDir, rootDir)
+
+	// out of any module, there is no root.
+	_, err = guessRootDir(ctx, t.TempDir(), "go", opts)
+	assert.ErrorContains(t, err, "can't guess the root dir of ")
+}
+
+func TestPrecompileBuildPackageRootDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go binary is a shell script")
+	}
+
+	// the fake go binary prints the directory it builds from.
+	goBinary := filepath.Join(t.TempDir(), "go")
+	err := os.WriteFile(goBinary, []byte("#!/bin/sh\n[ \"$1\" = build ] && pwd\nexit 1\n"), 0o755)
+	assert.NoError(t, err)
+
+	pkgDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(pkgDir, "foo.gno.gen.go"), []byte(GeneratedHeader+"\n\n//go:build gno\n\npackage foo\n"), 0o644)
+	assert.NoError(t, err)
+	rootDir := t.TempDir()
+	err = PrecompileBuildPackageWithOptions(context.Background(), pkgDir, PrecompileOptions{GoBinary: goBinary, RootDir: rootDir})
+	var buildErr *BuildError
+	if assert.True(t, errors.As(err, &buildErr)) {
+		assert.Equal(t, rootDir, strings.TrimSpace(buildErr.Output))
+	}
+}
+
+func TestPrecompileOffline(t *testing.T) {
+	assert.Nil(t, PrecompileOptions{}.buildEnv())
+	env := PrecompileOptions{Offline: true, BuildEnv: []string{"GOPROXY=https://proxy.golang.org", "GOFLAGS=-mod=mod"}}.buildEnv()
+	assert.Equal(t, []string{"GOPROXY=off", "GOFLAGS=-mod=readonly"}, env[len(env)-2:])
+
+	// example.com/missing can't be downloaded: the build fails at once.
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.19\n"), 0o644)
+	assert.NoError(t, err)
+	res, err := PrecompileWithFset(token.NewFileSet(), "package foo\n\nimport \"example.com/missing\"\n\nvar _ = missing.Foo\n", "gno", "foo.gno", PrecompileOptions{WhitelistMode: WhitelistOff})
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "foo.gno.gen.go"), []byte(res.Translated), 0o644)
+	assert.NoError(t, err)
+
+	opts := PrecompileOptions{GoBinary: "go", RootDir: dir, Offline: true}
+	err = PrecompileBuildPackageWithOptions(context.Background(), dir, opts)
+	assert.ErrorIs(t, err, ErrOffline)
+	assert.ErrorContains(t, err, "example.com/missing")
+
+	mempkg := &std.MemPackage{
+		Name:  "foo",
+		Path:  "gno.land/p/demo/foo",
+		Files: []*std.MemFile{{Name: "foo.gno", Body: "package foo\n\nimport \"example.com/missing\"\n\nvar _ = missing.Foo\n"}},
+	}
+	opts = PrecompileOptions{Gobuild: true, Offline: true, WhitelistMode: WhitelistOff}
+	_, err = PrecompileMemPkg(mempkg, opts)
+	assert.ErrorIs(t, err, ErrOffline)
+}
+
+func TestPrecompileBuildPackageTags(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.19\n"), 0o644)
+	assert.NoError(t, err)
+	res, err := Precompile("package foo\n", "gno", "a.gno")
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "a.gno.gen.go"), []byte(res.Translated), 0o644)
+	assert.NoError(t, err)
+	assert.NoError(t, PrecompileBuildPackage(dir, "go"))
+
+	// without a header, the file would also be built by a plain go build.
+	res, err = Precompile("package foo\n", NoHeaderTags, "b.gno")
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "b.gno.gen.go"), []byte(res.Translated), 0o644)
+	assert.NoError(t, err)
+	// excluded by its own constraint.
+	res, err = Precompile("//go:build !gno\n\npackage foo\n", "gno", "c.gno")
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "c.gno.gen.go"), []byte(res.Translated), 0o644)
+	assert.NoError(t, err)
+	// hand-written files are not checked.
+	err = os.WriteFile(filepath.Join(dir, "d.go"), []byte("package foo\n"), 0o644)
+	assert.NoError(t, err)
+
+	err = PrecompileBuildPackage(dir, "go")
+	assert.EqualError(t, err, filepath.Join(dir, "b.gno.gen.go")+": missing the gno build constraint; "+
+		filepath.Join(dir, "c.gno.gen.go")+": excluded from the build by its build constraints")
+}
+
+func TestGoBuildFiles(t *testing.T) {
+	dir := t.TempDir()
+	otherOS := "windows"
+	if runtime.GOOS == "windows" {
+		otherOS = "linux"
+	}
+	files := map[string]string{
+		"foo.gno.gen.go":                "//go:build gno\n\npackage foo\n",
+		"plain.go":                      "package foo\n",
+		"not_gno.gno.gen.go":            "//go:build !gno\n\npackage foo\n",
+		"ignored.go":                    "//go:build ignore\n\npackage main\n",
+		"gno_and_os.gno.gen.go":         "//go:build gno && " + runtime.GOOS + "\n\npackage foo\n",
+		"gno_and_other_os.gno.gen.go":   "//go:build gno && " + otherOS + "\n\npackage foo\n",
+		"suffix_" + otherOS + ".go":     "package foo\n",
+		"legacy.go":                     "// +build gno\n\npackage foo\n",
+		"foo_test.go":                   "package foo\n",
+		".foo_filetest.gno.gen_test.go": "//go:build gno\n\npackage main\n",
+		".foo_filetest.gno.gen.go":      "//go:build gno\n\npackage main\n",
+		"_underscore.go":                "package foo\n",
+		"foo.gno":                       "package foo\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		assert.NoError(t, err)
+	}
+
+	names, err := goBuildFiles(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo.gno.gen.go", "gno_and_os.gno.gen.go", "legacy.go", "plain.go"}, names)
+	// the files of other packages excluded by their tags don't count.
+	assert.NoError(t, verifySinglePackage(dir))
+}
+
+func TestPrecompileBuildPackageMultiplePackages(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/foo\n\ngo 1.19\n",
+		"a.gno":  "package foo\n",
+		"b.gno":  "package bar\n",
+		"c.gno":  "package foo\n",
+		// the external test package and the filetests are not built.
+		"d_test.gno":     "package foo_test\n",
+		"e_filetest.gno": "package main\n",
+	}
+	for name, content := range files {
+		if strings.HasSuffix(name, ".gno") {
+			targetFilename, tags := GetPrecompileFilenameAndTags(name)
+			res, err := Precompile(content, tags, name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			name, content = targetFilename, res.Translated
+		}
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		assert.NoError(t, err)
+	}
+
+	err := PrecompileBuildPackage(dir, "go")
+	assert.EqualError(t, err, "multiple packages in "+dir+": foo (a.gno.gen.go, c.gno.gen.go), bar (b.gno.gen.go)")
+
+	err = os.Remove(filepath.Join(dir, "b.gno.gen.go"))
+	assert.NoError(t, err)
+	assert.NoError(t, PrecompileBuildPackage(dir, "go"))
+}
+
+func TestPrecompileVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0o644)
+		assert.NoError(t, err)
+		return path
+	}
+	formatted := write("formatted.go", "package foo\n\nfunc Foo() {}\n")
+	unformatted := write("unformatted.go", "package foo\nfunc Foo() {  }\n")
+	invalid := write("invalid.go", "package foo\nfunc {\n")
+
+	assert.NoError(t, PrecompileVerifyFile(formatted, ""))
+	assert.EqualError(t, PrecompileVerifyFile(unformatted, ""), "gofmt: "+unformatted+" is not formatted")
+	assert.ErrorContains(t, PrecompileVerifyFile(invalid, ""), "gofmt: 2:6: expected 'IDENT', found '{'")
+
+	if _, err := exec.LookPath("gofmt"); err != nil {
+		t.Skip("gofmt not found")
+	}
+	assert.NoError(t, PrecompileVerifyFile(formatted, "gofmt"))
+	// gofmt -l only fails on syntax errors.
+	assert.NoError(t, PrecompileVerifyFile(unformatted, "gofmt"))
+	assert.Error(t, PrecompileVerifyFile(invalid, "gofmt"))
+}
+
+func BenchmarkPrecompileVerifyFile(b *testing.B) {
+	res, err := Precompile("package foo\n\nimport \"strings\"\n\nfunc Foo(s string) string {\n\treturn strings.ToUpper(s)\n}\n", "gno", "foo.gno")
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "foo.gno.gen.go")
+	if err := os.WriteFile(path, []byte(res.Translated), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("in-process", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := PrecompileVerifyFile(path, ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("gofmt", func(b *testing.B) {
+		if _, err := exec.LookPath("gofmt"); err != nil {
+			b.Skip("gofmt not found")
+		}
+		for i := 0; i < b.N; i++ {
+			if err := PrecompileVerifyFile(path, "gofmt"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package gnolang
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"go.uber.org/multierr"
+)
+
+// MissingDependencyError is returned by PrecompileMemPkgTree for an import
+// that is not in the package set.
+type MissingDependencyError struct {
+	// PkgPath is the package importing Import, from its file File.
+	PkgPath string
+	File    string
+	Import  string
+}
+
+func (e *MissingDependencyError) Error() string {
+	return fmt.Sprintf("%s: %s imports %s, which is not in the package set", e.File, e.PkgPath, e.Import)
+}
+
+// PrecompileMemPkgTree precompiles in memory the package of pkgs at the path
+// root, and the packages of pkgs it imports, directly or not, as
+// PrecompileMemPkg does for each of them. pkgs is keyed by package path,
+// e.g. the packages fetched from the chain state, and the imports are
+// resolved against it rather than the disk: the imports of packages, whose
+// first path element contains a dot as "gno.land", must all be in pkgs,
+// while the other ones are the standard libraries.
+//
+// It returns the reports of the precompiled packages by path, along with an
+// error combining the errors of all the packages. The packages are only
+// translated: opts.Gobuild, opts.Test and opts.Run are not supported, as the
+// go toolchain would resolve the imports on the disk.
+func PrecompileMemPkgTree(pkgs map[string]*std.MemPackage, root string, opts PrecompileOptions) (map[string]*PrecompileReport, error) {
+	if opts.Gobuild || opts.Test || opts.Run {
+		return nil, errors.New("precompile package tree: building, testing or running the packages is not supported")
+	}
+	if _, ok := pkgs[root]; !ok {
+		return nil, fmt.Errorf("precompile package tree: package %s is not in the package set", root)
+	}
+
+	// walk the closure of the imports of root.
+	var closure []*std.MemPackage
+	seen := map[string]bool{root: true}
+	queue := []string{root}
+	var errs error
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		mempkg := pkgs[path]
+		closure = append(closure, mempkg)
+
+		imports, err := memPkgDependencies(mempkg)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		for _, imp := range imports {
+			if seen[imp.path] {
+				continue
+			}
+			if _, ok := pkgs[imp.path]; !ok {
+				errs = multierr.Append(errs, &MissingDependencyError{PkgPath: path, File: imp.file, Import: imp.path})
+				continue
+			}
+			seen[imp.path] = true
+			queue = append(queue, imp.path)
+		}
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("precompile package tree: %w", errs)
+	}
+	if err := CheckImportCycles(closure, opts.rewriteRules()); err != nil {
+		return nil, fmt.Errorf("precompile package tree: %w", err)
+	}
+
+	sort.Slice(closure, func(i, j int) bool {
+		return closure[i].Path < closure[j].Path
+	})
+	reports := map[string]*PrecompileReport{}
+	for _, mempkg := range closure {
+		report, err := PrecompileMemPkg(mempkg, opts)
+		if report != nil {
+			reports[mempkg.Path] = report
+		}
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", mempkg.Path, err))
+		}
+	}
+	return reports, errs
+}
+
+// memPkgImport is an import of a package by one of its files.
+type memPkgImport struct {
+	path string
+	file string
+}
+
+// memPkgDependencies returns the packages imported by the .gno files of
+// mempkg, in the order of the files, but not the standard libraries nor the
+// package itself, imported by its filetests.
+func memPkgDependencies(mempkg *std.MemPackage) ([]memPkgImport, error) {
+	var imports []memPkgImport
+	seen := map[string]bool{}
+	for _, mfile := range mempkg.Files {
+		if !strings.HasSuffix(mfile.Name, ".gno") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), mfile.Name, mfile.Body, parser.ImportsOnly)
+		if err != nil {
+			return nil, fmt.Errorf("%s: parse: %w", mfile.Name, err)
+		}
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid import path %s: %w", mfile.Name, spec.Path.Value, err)
+			}
+			first := strings.SplitN(path, "/", 2)[0]
+			if !strings.Contains(first, ".") || path == mempkg.Path || seen[path] {
+				continue
+			}
+			seen[path] = true
+			imports = append(imports, memPkgImport{path: path, file: mfile.Name})
+		}
+	}
+	return imports, nil
+}
@@ -0,0 +1,59 @@
+package gnolang
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gnolang/gno/pkgs/std"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompileMemPkgTree(t *testing.T) {
+	pkgs := map[string]*std.MemPackage{
+		"gno.land/r/demo/a": {
+			Name: "a",
+			Path: "gno.land/r/demo/a",
+			Files: []*std.MemFile{
+				{Name: "a.gno", Body: "package a\n\nimport (\n\t\"strings\"\n\n\t\"gno.land/p/demo/b\"\n)\n\nfunc A() string { return strings.ToUpper(b.B()) }\n"},
+				{Name: "a_filetest.gno", Body: "package main\n\nimport \"gno.land/r/demo/a\"\n\nfunc main() { println(a.A()) }\n"},
+			},
+		},
+		"gno.land/p/demo/b": {
+			Name:  "b",
+			Path:  "gno.land/p/demo/b",
+			Files: []*std.MemFile{{Name: "b.gno", Body: "package b\n\nfunc B() string { return \"b\" }\n"}},
+		},
+		// not imported by a, so not precompiled.
+		"gno.land/p/demo/c": {
+			Name:  "c",
+			Path:  "gno.land/p/demo/c",
+			Files: []*std.MemFile{{Name: "c.gno", Body: "package c\n\nimport \"reflect\"\n"}},
+		},
+	}
+
+	reports, err := PrecompileMemPkgTree(pkgs, "gno.land/r/demo/a", PrecompileOptions{})
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "a.gno.gen.go", reports["gno.land/r/demo/a"].Files[0].TargetPath)
+		assert.Equal(t, "b.gno.gen.go", reports["gno.land/p/demo/b"].Files[0].TargetPath)
+	}
+
+	// the imports are resolved against the package set only.
+	delete(pkgs, "gno.land/p/demo/b")
+	_, err = PrecompileMemPkgTree(pkgs, "gno.land/r/demo/a", PrecompileOptions{})
+	var missingErr *MissingDependencyError
+	if assert.True(t, errors.As(err, &missingErr)) {
+		assert.Equal(t, &MissingDependencyError{PkgPath: "gno.land/r/demo/a", File: "a.gno", Import: "gno.land/p/demo/b"}, missingErr)
+	}
+	assert.EqualError(t, err, "precompile package tree: a.gno: gno.land/r/demo/a imports gno.land/p/demo/b, which is not in the package set")
+
+	_, err = PrecompileMemPkgTree(pkgs, "gno.land/p/demo/b", PrecompileOptions{})
+	assert.EqualError(t, err, "precompile package tree: package gno.land/p/demo/b is not in the package set")
+
+	// the errors of the packages are reported with their path.
+	_, err = PrecompileMemPkgTree(pkgs, "gno.land/p/demo/c", PrecompileOptions{})
+	assert.ErrorContains(t, err, "gno.land/p/demo/c: precompile package: c.gno:")
+
+	_, err = PrecompileMemPkgTree(pkgs, "gno.land/p/demo/c", PrecompileOptions{Gobuild: true})
+	assert.ErrorContains(t, err, "not supported")
+}